@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -11,6 +16,7 @@ import (
 
 	"github.com/gosuda/ako/generator/ai"
 	"github.com/gosuda/ako/generator/ci"
+	"github.com/gosuda/ako/generator/dev"
 	"github.com/gosuda/ako/generator/docker"
 	"github.com/gosuda/ako/generator/k8s"
 	"github.com/gosuda/ako/generator/lint"
@@ -288,6 +294,25 @@ var rootCmd = &cli.Command{
 						return nil
 					},
 				},
+				{
+					Name:    "arch",
+					Aliases: []string{"a"},
+					Usage:   "Check layer dependency rules",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						violations, err := packages.CheckArchitecture(command.Args().Slice()...)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(violations) > 0 {
+							packages.PrintArchViolations(violations)
+							return cli.Exit("architecture violations found", 1)
+						}
+
+						log.Println("No architecture violations found")
+						return nil
+					},
+				},
 				{
 					Name:    "build",
 					Usage:   "Build the Go application",
@@ -333,6 +358,19 @@ var rootCmd = &cli.Command{
 					Aliases: []string{"m"},
 					Usage:   "Create a new message and commit",
 					Action: func(ctx context.Context, command *cli.Command) error {
+						staged, err := git.ListStagedFiles()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(staged) > 0 {
+							tbl := table.NewTableBuilder("ALREADY STAGED")
+							for _, file := range staged {
+								tbl.AppendRow(file.String())
+							}
+							tbl.Print()
+						}
+
 						files, err := git.ListUnstagedFilesWithType()
 						if err != nil {
 							return cli.Exit(err.Error(), 1)
@@ -349,16 +387,40 @@ var rootCmd = &cli.Command{
 								return cli.Exit(err.Error(), 1)
 							}
 
-							if err := git.StageFiles(selected); err != nil {
+							hunkMode := false
+							for _, file := range selected {
+								if file.Type == git.FileTypeModified {
+									if err := survey.AskOne(&survey.Confirm{
+										Message: "Select hunks of modified files?",
+										Default: false,
+									}, &hunkMode); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+									break
+								}
+							}
+
+							snapshot, err := git.SnapshotGitIndex()
+							if err != nil {
 								return cli.Exit(err.Error(), 1)
 							}
 							defer func() {
 								if rollbackSwitch && len(selected) > 0 {
-									if err := git.UnstageFiles(selected); err != nil {
+									if err := git.RestoreGitIndex(snapshot); err != nil {
 										log.Printf("Error unstaging files: %s", err.Error())
 									}
 								}
 							}()
+
+							if hunkMode {
+								for _, file := range selected {
+									if err := git.StageFileHunks(file); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+								}
+							} else if err := git.StageFiles(selected); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
 						}
 
 						diff, err := git.GetDiffStagedFiles()
@@ -442,6 +504,133 @@ var rootCmd = &cli.Command{
 						}
 					},
 				},
+				{
+					Name:    "split",
+					Aliases: []string{"l"},
+					Usage:   "Split unstaged changes into several commits proposed by the LLM",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						staged, err := git.ListStagedFiles()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(staged) > 0 {
+							return cli.Exit("staged files found, commit or unstage them before splitting", 1)
+						}
+
+						changes, err := git.CollectSplitChanges()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(changes.Files) == 0 {
+							log.Println("No unstaged files found")
+							return nil
+						}
+
+						const maxGenerationErrorCount = 3
+						generationErrorCount := 0
+						var groups []git.CommitSplitGroup
+						for {
+							if groups == nil {
+								stream, err := ai.GenerateCommitSplit(ctx, changes.String())
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								generated := strings.Builder{}
+								for message := range stream {
+									generated.WriteString(message)
+								}
+
+								parsed, err := ai.GetCommitSplitOutputFrom(generated.String())
+								if err == nil {
+									groups, err = git.ParseCommitSplitPlan(parsed)
+								}
+								if err == nil {
+									_, err = changes.Validate(groups)
+								}
+								if err != nil {
+									log.Printf("Error parsing commit plan: %s", err.Error())
+									groups = nil
+									generationErrorCount++
+									if generationErrorCount >= maxGenerationErrorCount {
+										return cli.Exit(err.Error(), 1)
+									}
+									continue
+								}
+							}
+
+							leftovers, err := changes.Validate(groups)
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							git.PrintCommitSplitPlan(groups)
+							if len(leftovers) > 0 {
+								log.Printf("Left unstaged: %s", strings.Join(leftovers, ", "))
+							}
+
+							const (
+								commit     = "|> Commit"
+								edit       = "|> Edit"
+								regenerate = "|> Regenerate"
+								cancel     = "|> Cancel"
+							)
+							next := ""
+							if err := survey.AskOne(&survey.Select{
+								Message: "Confirm commit plan",
+								Options: []string{commit, edit, regenerate, cancel},
+							}, &next, survey.WithValidator(survey.Required)); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							switch next {
+							case regenerate:
+								log.Println("Retrying commit plan generation...")
+								groups = nil
+							case cancel:
+								log.Println("Commit plan cancelled")
+
+								return nil
+							case edit:
+								plan, err := git.MarshalCommitSplitPlan(groups)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								edited := ""
+								if err := survey.AskOne(&survey.Editor{
+									Message:       "Edit commit plan",
+									Default:       plan,
+									AppendDefault: true,
+									FileName:      "*.yaml",
+								}, &edited, survey.WithValidator(survey.Required)); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								editedGroups, err := git.ParseCommitSplitPlan(edited)
+								if err == nil {
+									_, err = changes.Validate(editedGroups)
+								}
+								if err != nil {
+									log.Printf("Invalid commit plan: %s", err.Error())
+									continue
+								}
+
+								groups = editedGroups
+							default:
+								if err := changes.Apply(groups); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Created %d commits", len(groups))
+
+								return nil
+							}
+						}
+					},
+				},
 				{
 					Name:    "create",
 					Aliases: []string{"c"},
@@ -470,6 +659,13 @@ var rootCmd = &cli.Command{
 					Name:    "up",
 					Aliases: []string{"u"},
 					Usage:   "Up to parent branch",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "worktree",
+							Aliases: []string{"w"},
+							Usage:   "move into the branch's worktree, creating it if missing",
+						},
+					},
 					Action: func(ctx context.Context, command *cli.Command) error {
 						branches, err := git.GetParentBranchName()
 						if err != nil {
@@ -488,7 +684,7 @@ var rootCmd = &cli.Command{
 							return cli.Exit(err.Error(), 1)
 						}
 
-						if err := git.SwitchGitBranchTo(selectedBranch); err != nil {
+						if err := git.MoveToGitBranch(selectedBranch, command.Bool("worktree")); err != nil {
 							return cli.Exit(err.Error(), 1)
 						}
 
@@ -499,6 +695,13 @@ var rootCmd = &cli.Command{
 					Name:    "down",
 					Aliases: []string{"d"},
 					Usage:   "Down to child branch",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "worktree",
+							Aliases: []string{"w"},
+							Usage:   "move into the branch's worktree, creating it if missing",
+						},
+					},
 					Action: func(ctx context.Context, command *cli.Command) error {
 						branches, err := git.GetChildrenBranchName()
 						if err != nil {
@@ -517,7 +720,7 @@ var rootCmd = &cli.Command{
 							return cli.Exit(err.Error(), 1)
 						}
 
-						if err := git.SwitchGitBranchTo(selectedBranch); err != nil {
+						if err := git.MoveToGitBranch(selectedBranch, command.Bool("worktree")); err != nil {
 							return cli.Exit(err.Error(), 1)
 						}
 
@@ -525,511 +728,2059 @@ var rootCmd = &cli.Command{
 					},
 				},
 				{
-					Name:    "tag",
-					Aliases: []string{"t"},
-					Usage:   "Manage Git tags",
+					Name:    "worktree",
+					Aliases: []string{"w"},
+					Usage:   "Manage a worktree per branch next to the repository",
 					Commands: []*cli.Command{
 						{
-							Name:    "set",
-							Aliases: []string{"s"},
-							Usage:   "Set a new tag",
+							Name:    "add",
+							Aliases: []string{"a"},
+							Usage:   "Check out a branch into its own worktree",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								tag, err := git.InputTag()
+								branches, err := git.ListBranchesWithoutWorktree()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								memo, err := git.InputTagMemo()
-								if err != nil {
+								const createSubBranch = "|> Create sub branch"
+								selectedBranch := ""
+								if err := survey.AskOne(&survey.Select{
+									Message: "Choose branch",
+									Options: append(branches, createSubBranch),
+								}, &selectedBranch, survey.WithValidator(survey.Required)); err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								if err := git.SetTag(tag, memo); err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+								create := false
+								if selectedBranch == createSubBranch {
+									currentBranch, err := git.GetGitBranchName()
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
 
-								log.Printf("Set tag: %s", tag)
-								return nil
-							},
-						},
-						{
-							Name:    "delete",
-							Aliases: []string{"d"},
-							Usage:   "Delete a tag",
-							Action: func(ctx context.Context, command *cli.Command) error {
-								tag, err := git.InputTag()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+									selectedBranch, err = git.MakeGitSubBranchName(currentBranch)
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
 
-								if err := git.DeleteTag(tag); err != nil {
-									return cli.Exit(err.Error(), 1)
+									create = true
 								}
 
-								log.Printf("Deleted tag: %s", tag)
-								return nil
-							},
-						},
-						{
-							Name:    "list",
-							Aliases: []string{"l"},
-							Usage:   "List all tags",
-							Action: func(ctx context.Context, command *cli.Command) error {
-								tags, err := git.ListTags()
+								dir, err := git.AddGitWorktree(selectedBranch, create)
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								if len(tags) == 0 {
-									log.Println("No tags found")
-									return nil
-								}
-
-								tbl := table.NewTableBuilder("TAG", "CREATED AT", "MEMO")
-
-								for _, tag := range tags {
-									tbl.AppendRow(tag.Name, tag.Date, tag.Memo)
-								}
-
-								tbl.Print()
+								log.Printf("Added worktree of %s: %s", selectedBranch, dir)
 
 								return nil
 							},
 						},
-					},
-				},
-			},
-		},
-		{
-			Name:    "linter",
-			Aliases: []string{"l"},
-			Usage:   "Run linter",
-			Action: func(ctx context.Context, command *cli.Command) error {
-				if err := lint.RunGolangcilint(); err != nil {
-					return cli.Exit(err.Error(), 1)
-				}
-
-				return nil
-			},
-		},
-		{
-			Name:    "k3d",
-			Aliases: []string{"k"},
-			Usage:   "Manage K3S manifests and clusters",
-			Commands: []*cli.Command{
-				{
-					Name:    "registry",
-					Aliases: []string{"r"},
-					Usage:   "Manage K3D registries",
-					Commands: []*cli.Command{
 						{
-							Name:    "create",
-							Aliases: []string{"c"},
-							Usage:   "Create a new K3D registry",
+							Name:    "shell",
+							Aliases: []string{"s"},
+							Usage:   "Print the shell function that lets ako move the shell into worktrees, for eval in your shell profile",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								name, err := k8s.InputK3dRegistryName()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
-
-								if err := k8s.CreateK3dRegistry(name); err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+								git.PrintGitWorktreeShellFunction()
 
-								log.Printf("Created K3D registry: %s", name)
 								return nil
 							},
 						},
 						{
-							Name:    "delete",
-							Aliases: []string{"d", "rm"},
-							Usage:   "Delete a K3D registry",
+							Name:    "list",
+							Aliases: []string{"ls", "l"},
+							Usage:   "List worktrees",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								selected, err := k8s.SelectK3dRegistryNames()
+								worktrees, err := git.ListGitWorktrees()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								for _, name := range selected {
-									if err := k8s.DeleteK3dRegistry(name); err != nil {
-										return cli.Exit(err.Error(), 1)
-									}
-
-									log.Printf("Deleted K3D registry: %s", name)
-								}
+								git.PrintGitWorktrees(worktrees)
 
 								return nil
 							},
 						},
 						{
-							Name:    "list",
-							Aliases: []string{"ls", "l"},
-							Usage:   "List K3D registries",
+							Name:    "remove",
+							Aliases: []string{"d", "rm"},
+							Usage:   "Remove worktrees",
+							Flags: []cli.Flag{
+								&cli.BoolFlag{
+									Name:    "force",
+									Aliases: []string{"f"},
+									Usage:   "remove worktrees with uncommitted changes",
+								},
+							},
 							Action: func(ctx context.Context, command *cli.Command) error {
-								registries, err := k8s.GetK3dRegistries()
+								selected, err := git.SelectWorktreesToRemove()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								if len(registries) == 0 {
-									log.Println("No registries found")
+								if len(selected) == 0 {
+									log.Println("No worktrees to remove")
 									return nil
 								}
 
-								tbl := table.NewTableBuilder("NAME", "IMAGE BUILD TAG", "MANIFEST TAG", "STATUS")
+								for _, worktree := range selected {
+									if err := git.RemoveGitWorktree(worktree.Path, command.Bool("force")); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
 
-								for _, registry := range registries {
-									addr := "localhost:" + registry.PortMappings.Five000TCP[0].HostPort
-									tbl.AppendRow(registry.Name, addr, registry.Name+"."+addr, registry.State.Status)
+									log.Printf("Removed worktree: %s", worktree.String())
 								}
 
-								tbl.Print()
-
 								return nil
 							},
 						},
 					},
 				},
 				{
-					Name:    "cluster",
-					Aliases: []string{"c"},
-					Usage:   "Manage K3D clusters",
-					Commands: []*cli.Command{
-						{
-							Name:    "create",
-							Aliases: []string{"c"},
-							Usage:   "Create a new K3D cluster",
-							Action: func(ctx context.Context, command *cli.Command) error {
-								name, err := k8s.InputK3dClusterName()
-								if err != nil {
+					Name:    "sync",
+					Aliases: []string{"s"},
+					Usage:   "Merge or rebase changes through the branch hierarchy",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						state, err := git.LoadBranchSyncState()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if state != nil {
+							const (
+								resume = "|> Continue"
+								abort  = "|> Abort"
+							)
+							next := ""
+							if err := survey.AskOne(&survey.Select{
+								Message: "Unfinished branch sync found",
+								Options: []string{resume, abort},
+							}, &next, survey.WithValidator(survey.Required)); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							if next == abort {
+								if err := state.Abort(); err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								agents, err := k8s.InputK3dClusterAgents()
-								if err != nil {
+								log.Println("Aborted branch sync")
+								return nil
+							}
+						} else {
+							direction, err := git.SelectBranchSyncDirection()
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							strategy := git.BranchSyncStrategyMerge
+							if direction == git.BranchSyncDirectionDown {
+								strategy, err = git.SelectBranchSyncStrategy()
+								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
+							}
 
-								portMap, err := k8s.InputK3dClusterLoadBalancerPortMap()
+							state, err = git.NewBranchSyncState(direction, strategy)
+							if err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+						}
+
+						if len(state.Steps) == 0 {
+							log.Println("No branch to sync")
+							return nil
+						}
+
+						err = state.Run()
+						state.Print()
+						if errors.Is(err, git.ErrBranchSyncConflict) {
+							log.Println("Resolve the conflict, commit it (or run 'git rebase --continue'), then run 'ako b sync' again")
+							return cli.Exit(err.Error(), 1)
+						}
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "tree",
+					Aliases: []string{"r"},
+					Usage:   "Show the branch hierarchy with ahead/behind status",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						roots, err := git.BuildBranchTree()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(roots) == 0 {
+							log.Println("No branches found")
+							return nil
+						}
+
+						for _, root := range roots {
+							fmt.Print(root.String())
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "prune",
+					Aliases: []string{"p"},
+					Usage:   "Delete merged or stale branches",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						days, err := git.InputStaleDays()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						branches, err := git.ListPrunableBranches(days)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(branches) == 0 {
+							log.Println("No branches to prune")
+							return nil
+						}
+
+						git.PrintPrunableBranches(branches)
+
+						selected, err := git.SelectBranchesToPrune(branches)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						selected, err = git.ConfirmStaleBranchDeletion(selected)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(selected) == 0 {
+							log.Println("No branches selected")
+							return nil
+						}
+
+						deleteRemote := false
+						if err := survey.AskOne(&survey.Confirm{
+							Message: "Delete the branches on origin as well?",
+							Default: false,
+						}, &deleteRemote); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						for _, branch := range selected {
+							if err := git.DeletePrunableBranch(branch); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+
+							if deleteRemote {
+								if err := git.DeleteRemoteGitBranch(branch.Name); err != nil {
+									log.Printf("Error deleting remote branch %s: %s", branch.Name, err.Error())
+								}
+							}
+
+							log.Printf("Deleted branch: %s", branch.Name)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "tag",
+					Aliases: []string{"t"},
+					Usage:   "Manage Git tags",
+					Commands: []*cli.Command{
+						{
+							Name:    "set",
+							Aliases: []string{"s"},
+							Usage:   "Set a new tag",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								tag, err := git.InputTag()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								registryData, err := k8s.SelectK3dRegistryName()
+								memo, err := git.InputTagMemo()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								if err := k8s.CreateK3dCluster(name, agents, registryData, portMap); err != nil {
+								if err := git.SetTag(tag, memo); err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								log.Printf("Created K3D cluster: %s", name)
+								log.Printf("Set tag: %s", tag)
 								return nil
 							},
 						},
 						{
 							Name:    "delete",
-							Aliases: []string{"d", "rm"},
-							Usage:   "Delete a K3D cluster",
+							Aliases: []string{"d"},
+							Usage:   "Delete a tag",
+							Flags: []cli.Flag{
+								&cli.BoolFlag{
+									Name:    "remote",
+									Aliases: []string{"r"},
+									Usage:   "also delete the tag on origin",
+								},
+							},
 							Action: func(ctx context.Context, command *cli.Command) error {
-								selected, err := k8s.SelectK3dClusterNames()
+								tag, err := git.InputTag()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								for _, name := range selected {
-									if err := k8s.DeleteK3dCluster(name); err != nil {
+								if err := git.DeleteTag(tag); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Deleted tag: %s", tag)
+
+								if command.Bool("remote") {
+									if err := git.DeleteRemoteTag(tag); err != nil {
 										return cli.Exit(err.Error(), 1)
 									}
 
-									log.Printf("Deleted K3D cluster: %s", name)
+									log.Printf("Deleted remote tag: %s", tag)
 								}
-
 								return nil
 							},
 						},
 						{
 							Name:    "list",
-							Aliases: []string{"ls", "l"},
-							Usage:   "List K3D clusters",
+							Aliases: []string{"l"},
+							Usage:   "List all tags",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								clusters, err := k8s.GetK3dClusters()
+								tags, err := git.ListTags()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								if len(clusters) == 0 {
-									log.Println("No clusters found")
+								if len(tags) == 0 {
+									log.Println("No tags found")
 									return nil
 								}
 
-								tbl := table.NewTableBuilder("NAME", "SERVERS", "AGENTS", "RUNNING", "OUTBOUND PORT (HOST -> CONTAINER)")
-
-								for _, cluster := range clusters {
-									builder := strings.Builder{}
-									for _, node := range cluster.Nodes {
-										const loadBalancerRole = "loadbalancer"
-										if node.Role == loadBalancerRole {
-											for k, v := range node.PortMappings {
-												for _, v := range v {
-													builder.WriteString(v.HostPort)
-													builder.WriteString(" -> ")
-													builder.WriteString(k)
-													builder.WriteString("\n")
-												}
-											}
-										}
-									}
-									tbl.AppendRow(cluster.Name, cluster.ServersCount, cluster.AgentsCount, (cluster.AgentsRunning > 0) && (cluster.ServersRunning > 0), builder.String())
-								}
-
-								tbl.Print()
+								git.PrintTags(tags)
 
 								return nil
 							},
 						},
 						{
-							Name:    "append-port",
-							Aliases: []string{"ap", "a"},
-							Usage:   "Append port to K3D cluster",
+							Name:    "push",
+							Aliases: []string{"p"},
+							Usage:   "Push local tags to origin",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								selected, err := k8s.SelectK3dClusterNames()
+								tags, err := git.ListTags()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								portMap, err := k8s.InputK3dClusterLoadBalancerPortMap()
+								selected, err := git.SelectTagsToPush(tags)
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								for _, name := range selected {
-									for h, c := range portMap {
-										if err := k8s.AddK3dClusterPort(name, h, c); err != nil {
-											return cli.Exit(err.Error(), 1)
-										}
-									}
+								if len(selected) == 0 {
+									log.Println("No tags to push")
+									return nil
+								}
 
-									log.Printf("Appended port to K3D cluster: %s", name)
+								if err := git.PushTag(selected...); err != nil {
+									return cli.Exit(err.Error(), 1)
 								}
 
+								log.Printf("Pushed tags: %s", strings.Join(selected, ", "))
 								return nil
 							},
 						},
 					},
 				},
+			},
+		},
+		{
+			Name:    "release",
+			Aliases: []string{"r"},
+			Usage:   "Manage the release pipeline",
+			Commands: []*cli.Command{
 				{
-					Name:    "manifest",
-					Aliases: []string{"m", "f"},
-					Usage:   "Manage K3D manifests",
-					Commands: []*cli.Command{
-						{
-							Name:    "init",
-							Aliases: []string{"i"},
-							Usage:   "Initialize a new K3D manifest",
-							Action: func(ctx context.Context, command *cli.Command) error {
-								selectedCluster, err := k8s.SelectK3dClusterName()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
-
-								selectedLocalRegistry, err := k8s.SelectK3dRegistryForCluster()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+					Name:    "promote",
+					Aliases: []string{"p"},
+					Usage:   "Promote develop to staging or staging to release",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						pending, err := git.LoadBranchSyncState()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								namespace, err := k8s.InputK8sNamespace()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						if pending != nil {
+							return cli.Exit("Unfinished branch sync found, run 'ako b sync' to continue or abort it", 1)
+						}
 
-								remoteRegistry, err := k8s.InputK8sRemoteRegistry()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						source, err := git.GetGitBranchName()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								k8s.GlobalConfig.Cluster = selectedCluster
-								k8s.GlobalConfig.Namespace = namespace
-								k8s.GlobalConfig.LocalRegistry = selectedLocalRegistry
-								k8s.GlobalConfig.RemoteRegistry = remoteRegistry
-								if err := k8s.SaveK3dConfig(); err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						target, err := git.GetPromotionTarget(source)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								if err := k8s.GenerateK8sNamespaceFile(namespace); err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						clean, err := git.IsGitWorkingTreeClean()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								if err := k8s.GenerateK8sIngressFile(namespace, "public"); err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						if !clean {
+							return cli.Exit("working tree has uncommitted changes", 1)
+						}
 
-								if err := k8s.GenerateK8sIngressFile(namespace, "private"); err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						upToDate, err := git.IsGitBranchUpToDate(source)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								log.Printf("Initialized K3D manifest for cluster: %s", selectedCluster)
-								log.Printf("Local registry: %s", selectedLocalRegistry)
-								log.Printf("Remote registry: %s", remoteRegistry)
-								log.Printf("Namespace: %s", namespace)
+						if !upToDate {
+							return cli.Exit(source+" is behind origin, pull it first", 1)
+						}
 
-								log.Printf("K3D manifest initialized successfully")
+						log.Println("Running tests")
+						if err := module.RunGoTest(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								return nil
-							},
-						},
-						{
-							Name:    "create",
-							Aliases: []string{"c"},
-							Usage:   "Create a new K3D manifest",
-							Action: func(ctx context.Context, command *cli.Command) error {
-								selectedCmd, err := packages.SelectCmdName()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						log.Println("Running linter")
+						if err := lint.RunGolangcilint(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								selectedKind, err := k8s.SelectK8sManifestKind()
-								if err != nil {
-									return cli.Exit(err.Error(), 1)
-								}
+						tag, err := git.InputReleaseTag(target)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-								cmds := strings.Split(selectedCmd, "/")
+						changelog, err := git.GenerateReleaseChangelog(source)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						memo := "release " + tag
+						if changelog != "" {
+							memo += "\n\n" + changelog
+						}
+
+						log.Printf("Tag memo for %s:\n%s", tag, memo)
+
+						state := git.NewPromotionState(source, target, tag, memo)
+						err = state.Run()
+						state.Print()
+						if errors.Is(err, git.ErrBranchSyncConflict) {
+							log.Println("Resolve the conflict, commit it, then run 'ako b sync' to continue")
+							return cli.Exit(err.Error(), 1)
+						}
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						push := false
+						if err := survey.AskOne(&survey.Confirm{
+							Message: fmt.Sprintf("Push %s and %s to origin?", target, tag),
+							Default: true,
+						}, &push); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if !push {
+							log.Printf("Promoted %s to %s as %s", source, target, tag)
+							return nil
+						}
+
+						if err := git.PushGitBranch(target); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := git.PushTag(tag); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Promoted %s to %s as %s", source, target, tag)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:    "hotfix",
+			Aliases: []string{"x"},
+			Usage:   "Manage hotfix branches",
+			Commands: []*cli.Command{
+				{
+					Name:    "start",
+					Aliases: []string{"s"},
+					Usage:   "Create a hotfix branch from release",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						name, err := git.InputHotfixName()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						branch, err := git.StartHotfix(name)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Switched to branch: %s", branch)
+						return nil
+					},
+				},
+				{
+					Name:    "finish",
+					Aliases: []string{"f"},
+					Usage:   "Merge the hotfix into release, tag it and back-merge into staging and develop",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						pending, err := git.LoadBranchSyncState()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if pending != nil {
+							return cli.Exit("Unfinished branch sync found, run 'ako b sync' to continue or abort it", 1)
+						}
+
+						hotfixBranch, err := git.GetGitBranchName()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						tag, err := git.InputHotfixTag()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						state, err := git.NewHotfixFinishState(tag)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						err = state.Run()
+						state.Print()
+						if errors.Is(err, git.ErrBranchSyncConflict) {
+							log.Println("Resolve the conflict, commit it, then run 'ako b sync' to continue")
+							return cli.Exit(err.Error(), 1)
+						}
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Finished hotfix: %s", hotfixBranch)
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:    "hooks",
+			Aliases: []string{"hk"},
+			Usage:   "Manage Git hooks",
+			Commands: []*cli.Command{
+				{
+					Name:    "install",
+					Aliases: []string{"i"},
+					Usage:   "Install commit-msg, pre-commit and pre-push hooks",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := git.InstallGitHooks(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "uninstall",
+					Aliases: []string{"u"},
+					Usage:   "Remove hooks installed by ako",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := git.UninstallGitHooks(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:   git.GitHookCommitMsg,
+					Usage:  "Validate the commit message (called by git)",
+					Hidden: true,
+					Action: func(ctx context.Context, command *cli.Command) error {
+						message, err := git.ReadCommitMessageFile(command.Args().First())
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						branch, err := git.GetGitBranchName()
+						if err != nil || branch == "HEAD" {
+							branch = ""
+						}
+
+						failed := false
+						for _, issue := range git.LintCommitMessage(message, branch) {
+							log.Printf("[%s] %s: %s", issue.Level, issue.Rule, issue.Message)
+							if issue.Level == git.CommitLintLevelError {
+								failed = true
+							}
+						}
+
+						if failed {
+							return cli.Exit("invalid commit message", 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:   git.GitHookPreCommit,
+					Usage:  "Validate the branch name, architecture and lint (called by git)",
+					Hidden: true,
+					Action: func(ctx context.Context, command *cli.Command) error {
+						branch, err := git.GetGitBranchName()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						// Detached HEAD happens during rebase and bisect, there is no branch name to check.
+						if branch != "HEAD" {
+							if err := git.ValidateGitBranchName(branch); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+						}
+
+						changed, err := git.ListStagedGoPackages()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(changed) == 0 {
+							return nil
+						}
+
+						// Check a snapshot of the index, so unstaged changes in the working tree neither hide
+						// nor cause failures.
+						snapshot, err := git.ExportGitIndex()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+						defer os.RemoveAll(snapshot)
+
+						wd, err := os.Getwd()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := os.Chdir(snapshot); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+						defer os.Chdir(wd)
+
+						violations, err := packages.CheckArchitecture(changed...)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if len(violations) > 0 {
+							packages.PrintArchViolations(violations)
+							return cli.Exit("architecture violations found", 1)
+						}
+
+						if err := lint.RunGolangcilintOnPackages(changed...); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:   git.GitHookPrePush,
+					Usage:  "Validate pushed branch names (called by git)",
+					Hidden: true,
+					Action: func(ctx context.Context, command *cli.Command) error {
+						branches, err := git.ListPushedBranches(os.Stdin)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						for _, branch := range branches {
+							if err := git.ValidateGitBranchName(branch); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+						}
+
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:    "linter",
+			Aliases: []string{"l", "lint"},
+			Usage:   "Run linter",
+			Commands: []*cli.Command{
+				{
+					Name:      "commits",
+					Aliases:   []string{"c"},
+					Usage:     "Lint commit messages against the Conventional Commits rules",
+					ArgsUsage: "[range]",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "format",
+							Aliases: []string{"o"},
+							Usage:   "output format (text, json)",
+							Value:   "text",
+						},
+						&cli.StringFlag{
+							Name:    "branch",
+							Aliases: []string{"b"},
+							Usage:   "branch name used for hierarchy hints (default: current branch)",
+						},
+					},
+					Action: func(ctx context.Context, command *cli.Command) error {
+						branch := command.String("branch")
+						if branch == "" {
+							current, err := git.GetGitBranchName()
+							if err == nil && current != "HEAD" {
+								branch = current
+							}
+						}
+
+						revRange := command.Args().First()
+						if revRange == "" {
+							if parents, err := git.GetParentBranchName(); err == nil && len(parents) > 0 {
+								revRange = parents[0] + "..HEAD"
+							}
+						}
+
+						results, err := git.LintCommitRange(revRange, branch)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						switch command.String("format") {
+						case "json":
+							encoder := json.NewEncoder(os.Stdout)
+							encoder.SetIndent("", "  ")
+							if err := encoder.Encode(results); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+						case "text":
+							git.PrintCommitLintResults(results)
+						default:
+							return cli.Exit("unknown output format: "+command.String("format"), 1)
+						}
+
+						for _, result := range results {
+							if !result.Valid {
+								return cli.Exit("", 1)
+							}
+						}
+
+						return nil
+					},
+				},
+			},
+			Action: func(ctx context.Context, command *cli.Command) error {
+				if err := lint.RunGolangcilint(); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:    "k3d",
+			Aliases: []string{"k"},
+			Usage:   "Manage K3S manifests and clusters",
+			Commands: []*cli.Command{
+				{
+					Name:    "registry",
+					Aliases: []string{"r"},
+					Usage:   "Manage K3D registries",
+					Commands: []*cli.Command{
+						{
+							Name:    "create",
+							Aliases: []string{"c"},
+							Usage:   "Create a new K3D registry",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								name, err := k8s.InputK3dRegistryName()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.CreateK3dRegistry(name); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Created K3D registry: %s", name)
+								return nil
+							},
+						},
+						{
+							Name:    "delete",
+							Aliases: []string{"d", "rm"},
+							Usage:   "Delete a K3D registry",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								selected, err := k8s.SelectK3dRegistryNames()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								for _, name := range selected {
+									if err := k8s.DeleteK3dRegistry(name); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									log.Printf("Deleted K3D registry: %s", name)
+								}
+
+								return nil
+							},
+						},
+						{
+							Name:    "list",
+							Aliases: []string{"ls", "l"},
+							Usage:   "List K3D registries",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								registries, err := k8s.GetK3dRegistries()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if len(registries) == 0 {
+									log.Println("No registries found")
+									return nil
+								}
+
+								tbl := table.NewTableBuilder("NAME", "IMAGE BUILD TAG", "MANIFEST TAG", "STATUS")
+
+								for _, registry := range registries {
+									addr := "localhost:" + registry.PortMappings.Five000TCP[0].HostPort
+									tbl.AppendRow(registry.Name, addr, registry.Name+"."+addr, registry.State.Status)
+								}
+
+								tbl.Print()
+
+								return nil
+							},
+						},
+					},
+				},
+				{
+					Name:    "cluster",
+					Aliases: []string{"c"},
+					Usage:   "Manage K3D clusters",
+					Commands: []*cli.Command{
+						{
+							Name:    "create",
+							Aliases: []string{"c"},
+							Usage:   "Create a new K3D cluster and save its config to reproduce it",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								if k8s.K3dClusterConfigExists() {
+									overwrite := false
+									if err := survey.AskOne(&survey.Confirm{
+										Message: k8s.GetK3dClusterConfigPath() + " already exists, overwrite it?",
+										Default: false,
+									}, &overwrite); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									if !overwrite {
+										log.Println("Run 'ako k3d cluster up' to create the cluster from the existing config")
+										return nil
+									}
+								}
+
+								name, err := k8s.InputK3dClusterName()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								agents, err := k8s.InputK3dClusterAgents()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								portMap, err := k8s.InputK3dClusterLoadBalancerPortMap()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								registryData, err := k8s.SelectK3dRegistryName()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								volumes, err := k8s.InputK3dClusterVolumes()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								disabledComponents, err := k8s.SelectK3dDisabledComponents()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.SaveK3dClusterConfig(k8s.NewK3dClusterConfig(name, agents, registryData, portMap, volumes, disabledComponents)); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Saved K3D cluster config: %s", k8s.GetK3dClusterConfigPath())
+
+								if err := k8s.CreateK3dCluster(); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Created K3D cluster: %s", name)
+								return nil
+							},
+						},
+						{
+							Name:    "up",
+							Aliases: []string{"u"},
+							Usage:   "Create the K3D cluster from its saved config, or add the ports missing from it",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								if err := k8s.UpK3dCluster(); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								return nil
+							},
+						},
+						{
+							Name:    "delete",
+							Aliases: []string{"d", "rm"},
+							Usage:   "Delete a K3D cluster",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								selected, err := k8s.SelectK3dClusterNames()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								for _, name := range selected {
+									if err := k8s.DeleteK3dCluster(name); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									log.Printf("Deleted K3D cluster: %s", name)
+								}
+
+								return nil
+							},
+						},
+						{
+							Name:    "list",
+							Aliases: []string{"ls", "l"},
+							Usage:   "List K3D clusters",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								clusters, err := k8s.GetK3dClusters()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if len(clusters) == 0 {
+									log.Println("No clusters found")
+									return nil
+								}
+
+								tbl := table.NewTableBuilder("NAME", "SERVERS", "AGENTS", "RUNNING", "OUTBOUND PORT (HOST -> CONTAINER)")
+
+								for _, cluster := range clusters {
+									builder := strings.Builder{}
+									for _, node := range cluster.Nodes {
+										const loadBalancerRole = "loadbalancer"
+										if node.Role == loadBalancerRole {
+											for k, v := range node.PortMappings {
+												for _, v := range v {
+													builder.WriteString(v.HostPort)
+													builder.WriteString(" -> ")
+													builder.WriteString(k)
+													builder.WriteString("\n")
+												}
+											}
+										}
+									}
+									tbl.AppendRow(cluster.Name, cluster.ServersCount, cluster.AgentsCount, (cluster.AgentsRunning > 0) && (cluster.ServersRunning > 0), builder.String())
+								}
+
+								tbl.Print()
+
+								return nil
+							},
+						},
+						{
+							Name:    "append-port",
+							Aliases: []string{"ap", "a"},
+							Usage:   "Append port to K3D cluster",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								selected, err := k8s.SelectK3dClusterNames()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								portMap, err := k8s.InputK3dClusterLoadBalancerPortMap()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								for _, name := range selected {
+									for h, c := range portMap {
+										if err := k8s.AddK3dClusterPort(name, h, c); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+									}
+
+									log.Printf("Appended port to K3D cluster: %s", name)
+
+									recorded, err := k8s.RecordK3dClusterPorts(name, portMap)
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									if recorded {
+										log.Printf("Recorded ports in K3D cluster config: %s", k8s.GetK3dClusterConfigPath())
+									}
+								}
+
+								return nil
+							},
+						},
+					},
+				},
+				{
+					Name:    "manifest",
+					Aliases: []string{"m", "f"},
+					Usage:   "Manage K3D manifests",
+					Commands: []*cli.Command{
+						{
+							Name:    "init",
+							Aliases: []string{"i"},
+							Usage:   "Initialize a new K3D manifest",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								selectedCluster, err := k8s.SelectK3dClusterName()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								selectedLocalRegistry, err := k8s.SelectK3dRegistryForCluster()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								namespace, err := k8s.InputK8sNamespace()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								remoteRegistry, err := k8s.InputK8sRemoteRegistry()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								k8s.GlobalConfig.Cluster = selectedCluster
+								k8s.GlobalConfig.Namespace = namespace
+								k8s.GlobalConfig.LocalRegistry = selectedLocalRegistry
+								k8s.GlobalConfig.RemoteRegistry = remoteRegistry
+								if err := k8s.SaveK3dConfig(); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.GenerateK8sNamespaceFile(namespace); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.GenerateK8sIngressFile(namespace, "public"); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.GenerateK8sIngressFile(namespace, "private"); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Initialized K3D manifest for cluster: %s", selectedCluster)
+								log.Printf("Local registry: %s", selectedLocalRegistry)
+								log.Printf("Remote registry: %s", remoteRegistry)
+								log.Printf("Namespace: %s", namespace)
+
+								log.Printf("K3D manifest initialized successfully")
+
+								return nil
+							},
+						},
+						{
+							Name:    "create",
+							Aliases: []string{"c"},
+							Usage:   "Create a new K3D manifest",
+							Flags: []cli.Flag{
+								&cli.BoolFlag{
+									Name:  "helm",
+									Usage: "generate a subchart of the namespace's Helm chart instead of raw manifests",
+								},
+								&cli.BoolFlag{
+									Name:  "kustomize",
+									Usage: "generate a kustomize base with local and remote overlays instead of raw manifests",
+								},
+							},
+							Action: func(ctx context.Context, command *cli.Command) error {
+								selectedCmd, err := packages.SelectCmdName()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								selectedKind, err := k8s.SelectK8sManifestKind()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								cmds := strings.Split(selectedCmd, "/")
+
+								if command.Bool("helm") || command.Bool("kustomize") {
+									tier := ""
+									var policies []string
+									var metric *k8s.K8sHPAMetric
+									if selectedKind != k8s.K8sManifestKindCronJob {
+										tier, err = k8s.SelectK8sDeploymentTier()
+										if err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										policies, metric, err = k8s.InputK8sPolicies(selectedKind, tier)
+										if err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+									}
+
+									if command.Bool("helm") {
+										if err := k8s.GenerateHelmChart(selectedKind, tier, policies, metric, k8s.GlobalConfig.Namespace, cmds...); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										log.Printf("Created Helm chart for command: %s", selectedCmd)
+									}
+
+									if command.Bool("kustomize") {
+										if err := k8s.GenerateKustomizeManifests(selectedKind, tier, policies, metric, k8s.GlobalConfig.Namespace, cmds...); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										log.Printf("Created kustomize manifests for command: %s", selectedCmd)
+									}
+
+									return nil
+								}
+
+								tier := ""
+								switch selectedKind {
+								case k8s.K8sManifestKindDeployment:
+									tier, err = k8s.SelectK8sDeploymentTier()
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									if err := k8s.GenerateK8sDeploymentFile(tier, k8s.GlobalConfig.Namespace, cmds...); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									if err := k8s.GenerateK8sServiceFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+								case k8s.K8sManifestKindCronJob:
+									if err := k8s.GenerateK8sCronJobFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+								case k8s.K8sManifestKindStatefulSet, k8s.K8sManifestKindJob, k8s.K8sManifestKindDaemonSet:
+									tier, err = k8s.SelectK8sDeploymentTier()
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									resources, err := k8s.InputK8sResources()
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									if err := k8s.GenerateK8sWorkloadFile(selectedKind, tier, resources, k8s.GlobalConfig.Namespace, cmds...); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+								default:
+									log.Printf("Unknown K3D manifest kind: %s", selectedKind)
+									return cli.Exit("Unknown K3D manifest kind", 1)
+								}
+
+								if tier != "" {
+									policies, metric, err := k8s.InputK8sPolicies(selectedKind, tier)
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									for _, policy := range policies {
+										switch policy {
+										case k8s.K8sPolicyHPA:
+											if err := k8s.GenerateK8sHPAFile(selectedKind, tier, metric, k8s.GlobalConfig.Namespace, cmds...); err != nil {
+												return cli.Exit(err.Error(), 1)
+											}
+										case k8s.K8sPolicyPDB:
+											if err := k8s.GenerateK8sPDBFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+												return cli.Exit(err.Error(), 1)
+											}
+										case k8s.K8sPolicyNetworkPolicy:
+											if err := k8s.GenerateK8sNetworkPolicyFile(tier, k8s.GlobalConfig.Namespace, cmds...); err != nil {
+												return cli.Exit(err.Error(), 1)
+											}
+										}
+									}
+								}
+
+								if err := k8s.GenerateK8sConfigMap(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.GenerateK8sSecretFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.GenerateK8sPvcFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								log.Printf("Created K3D manifest for command: %s", selectedCmd)
+
+								return nil
+							},
+						},
+						{
+							Name:    "build",
+							Aliases: []string{"b", "d", "deploy"},
+							Usage:   "Build cmd and push to local registry",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								selectedCmd, err := packages.SelectCmdName()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								cmds := strings.Split(selectedCmd, "/")
+
+								version, err := docker.BuildDockerImage(cmds...)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								head, err := git.DescribeGitHead()
+								if err != nil {
+									log.Printf("failed to describe the git HEAD: %v", err)
+								}
+
+								changeCause := k8s.MakeK8sChangeCause(version, head)
+								updated, err := k8s.SetK8sDeploymentBuild(version, changeCause, cmds...)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if updated {
+									log.Printf("Set the local deployment to %s: %s", version, changeCause)
+								}
+
+								updated, err = k8s.SetHelmChartBuild(version, changeCause, cmds...)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if updated {
+									log.Printf("Set the local helm values to %s", version)
+								}
+
+								updated, err = k8s.SetKustomizeOverlayBuild(version, cmds...)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if updated {
+									log.Printf("Set the local kustomize overlay to %s", version)
+								}
+
+								log.Printf("Built K3D manifest for command: %s", selectedCmd)
+
+								return nil
+							},
+						},
+						{
+							Name:      "apply",
+							Aliases:   []string{"a"},
+							Usage:     "Apply K3D manifests in dependency order, after previewing the changes",
+							ArgsUsage: "[file|directory|app...]",
+							Flags: []cli.Flag{
+								&cli.BoolFlag{
+									Name:    "kustomize",
+									Aliases: []string{"k"},
+									Usage:   "apply a kustomize overlay instead of manifest files",
+								},
+								&cli.StringFlag{
+									Name:    "env",
+									Aliases: []string{"e"},
+									Usage:   "env of the manifests applied from directories and apps (local, remote)",
+									Value:   "local",
+								},
+								&cli.BoolFlag{
+									Name:    "diff",
+									Aliases: []string{"d"},
+									Usage:   "show the diff of the changed resources against the cluster",
+								},
+								&cli.BoolFlag{
+									Name:    "yes",
+									Aliases: []string{"y"},
+									Usage:   "apply without asking for confirmation",
+								},
+							},
+							Action: func(ctx context.Context, command *cli.Command) error {
+								var plan *k8s.K8sApplyPlan
+								if command.Bool("kustomize") {
+									overlay, err := k8s.SelectKustomizeOverlay()
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									plan, err = k8s.PlanKustomizeOverlay(ctx, overlay)
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+								} else {
+									var selectedManifests []string
+									var err error
+									if command.Args().Len() > 0 {
+										selectedManifests, err = k8s.ResolveK8sManifests(command.String("env"), command.Args().Slice()...)
+									} else {
+										selectedManifests, err = k8s.SelectK8sManifest()
+									}
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									plan, err = k8s.PlanK8sApply(ctx, selectedManifests)
+									if err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+								}
+
+								if err := k8s.PrintK8sApplyPlan(plan, command.Bool("diff")); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if !plan.Pending() {
+									log.Println("Nothing to apply")
+									return nil
+								}
+
+								if !command.Bool("yes") {
+									confirmed := false
+									if err := survey.AskOne(&survey.Confirm{
+										Message: "Apply these changes?",
+										Default: false,
+									}, &confirmed); err != nil {
+										return cli.Exit(err.Error(), 1)
+									}
+
+									if !confirmed {
+										log.Println("Apply cancelled")
+										return nil
+									}
+								}
+
+								results := k8s.ApplyK8sPlan(ctx, plan)
+								k8s.PrintK8sApplyResults(results)
+								if failures := k8s.CountK8sApplyFailures(results); failures > 0 {
+									return cli.Exit(fmt.Sprintf("failed to apply %d resources", failures), 1)
+								}
+
+								log.Printf("Applied K3D manifests successfully")
+
+								return nil
+							},
+						},
+						{
+							Name:    "get",
+							Aliases: []string{"g"},
+							Usage:   "Get K3D resources",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:    "output",
+									Aliases: []string{"o"},
+									Usage:   "output format (" + strings.Join(k8s.K8sOutputs, ", ") + ")",
+									Value:   k8s.K8sOutputTable,
+								},
+							},
+							Commands: []*cli.Command{
+								{
+									Name:    "pods",
+									Aliases: []string{"p", "po"},
+									Usage:   "Get K3D pods",
+									Action: func(ctx context.Context, command *cli.Command) error {
+										if err := k8s.RunK8sGetPods(ctx, command.String("output")); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										return nil
+									},
+								},
+								{
+									Name:    "services",
+									Aliases: []string{"s", "svc"},
+									Usage:   "Get K3D services",
+									Action: func(ctx context.Context, command *cli.Command) error {
+										if err := k8s.RunK8sGetServices(ctx, command.String("output")); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										return nil
+									},
+								},
+								{
+									Name:    "deployments",
+									Aliases: []string{"d", "deploy"},
+									Usage:   "Get K3D deployments",
+									Action: func(ctx context.Context, command *cli.Command) error {
+										if err := k8s.RunK8sGetDeployments(ctx, command.String("output")); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										return nil
+									},
+								},
+								{
+									Name:    "ingress",
+									Aliases: []string{"i"},
+									Usage:   "Get K3D ingress",
+									Action: func(ctx context.Context, command *cli.Command) error {
+										if err := k8s.RunK8sGetIngress(ctx, command.String("output")); err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										return nil
+									},
+								},
+							},
+						},
+						{
+							Name:    "route",
+							Aliases: []string{"r"},
+							Usage:   "Manage routes of the public and private ingresses",
+							Commands: []*cli.Command{
+								{
+									Name:    "add",
+									Aliases: []string{"a"},
+									Usage:   "Route a path or host of an ingress to a cmd's service",
+									Flags: []cli.Flag{
+										&cli.StringFlag{
+											Name:    "output",
+											Aliases: []string{"o"},
+											Usage:   "route manifest to write (" + strings.Join(k8s.K8sRouteOutputs, ", ") + ")",
+											Value:   k8s.K8sRouteOutputIngress,
+										},
+									},
+									Action: func(ctx context.Context, command *cli.Command) error {
+										output := command.String("output")
+										if !slices.Contains(k8s.K8sRouteOutputs, output) {
+											return cli.Exit("Unknown route output: "+output, 1)
+										}
+
+										service, err := k8s.SelectK8sRouteService()
+										if err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										ingress, err := k8s.SelectK8sIngress()
+										if err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										host, path, err := k8s.InputK8sRouteHostAndPath(service.AppName)
+										if err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										file, err := k8s.AddK8sRoute(output, k8s.K8sRoute{
+											Ingress: ingress,
+											Host:    host,
+											Path:    path,
+											Service: *service,
+										})
+										if err != nil {
+											return cli.Exit(err.Error(), 1)
+										}
+
+										log.Printf("Routed %s%s to %s:%d in %s", host, path, service.Name, service.Port, file)
+
+										return nil
+									},
+								},
+							},
+						},
+						{
+							Name:    "validate",
+							Aliases: []string{"v"},
+							Usage:   "Validate manifests against the Kubernetes schemas and best practices, offline",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "served-by",
+									Usage: "Kubernetes version whose served apiVersions the manifests must use",
+									Value: k8s.K8sServedAPIsVersion,
+								},
+							},
+							Action: func(ctx context.Context, command *cli.Command) error {
+								issues, err := k8s.ValidateK8sManifests(command.String("served-by"))
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if len(issues) == 0 {
+									log.Println("All manifests are valid")
+									return nil
+								}
+
+								k8s.PrintK8sValidationIssues(issues)
+								if k8s.HasK8sValidationErrors(issues) {
+									return cli.Exit("invalid manifests found", 1)
+								}
+
+								return nil
+							},
+						},
+					},
+				},
+				{
+					Name:      "logs",
+					Aliases:   []string{"l", "log"},
+					Usage:     "Print the logs of every pod of an app, prefixed with the pod",
+					ArgsUsage: "[app|cmd]",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:    "follow",
+							Aliases: []string{"f"},
+							Usage:   "follow the logs of all pods at once",
+						},
+						&cli.IntFlag{
+							Name:  "tail",
+							Usage: "number of recent lines of each pod to show, -1 for all",
+							Value: 100,
+						},
+						&cli.StringFlag{
+							Name:  "since",
+							Usage: "only show logs newer than a duration, such as 5m",
+						},
+						&cli.StringFlag{
+							Name:    "container",
+							Aliases: []string{"c"},
+							Usage:   "container to show the logs of (default: all containers)",
+						},
+						&cli.BoolFlag{
+							Name:    "previous",
+							Aliases: []string{"p"},
+							Usage:   "show the logs of the previous, crashed container",
+						},
+					},
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						appName, err := k8s.SelectK8sAppName(command.Args().First())
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := k8s.StreamK8sAppLogs(ctx, appName, k8s.K8sLogsOption{
+							Follow:    command.Bool("follow"),
+							Tail:      command.Int("tail"),
+							Since:     command.String("since"),
+							Container: command.String("container"),
+							Previous:  command.Bool("previous"),
+						}); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "exec",
+					Aliases:   []string{"e"},
+					Usage:     "Run a command in a pod of an app, a shell by default",
+					ArgsUsage: "[app|cmd] [-- command...]",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "container",
+							Aliases: []string{"c"},
+							Usage:   "container to run the command in (default: the first container)",
+						},
+					},
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						appName, err := k8s.SelectK8sAppName(command.Args().First())
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						pod, err := k8s.SelectK8sAppPod(ctx, appName)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						args := command.Args().Tail()
+						if len(args) == 0 {
+							args = []string{"/bin/sh"}
+						}
+
+						if err := k8s.ExecK8sPod(ctx, pod, command.String("container"), args...); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:      "port-forward",
+					Aliases:   []string{"p", "pf"},
+					Usage:     "Forward local ports to a pod of an app, its container ports by default",
+					ArgsUsage: "[app|cmd] [[local:]remote...]",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						appName, err := k8s.SelectK8sAppName(command.Args().First())
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						pod, err := k8s.SelectK8sAppPod(ctx, appName)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Forwarding to %s, press Ctrl+C to stop", pod.Name)
+						if err := k8s.PortForwardK8sPod(ctx, pod, command.Args().Tail()...); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						return nil
+					},
+				},
+				{
+					Name:    "rollout",
+					Aliases: []string{"o", "ro"},
+					Usage:   "Watch, list and roll back the rollouts of an app",
+					Commands: []*cli.Command{
+						{
+							Name:      "status",
+							Aliases:   []string{"s"},
+							Usage:     "Wait for the rollout of an app to finish",
+							ArgsUsage: "[app|cmd]",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								if err := k8s.CheckK3dConfig(); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								appName, err := k8s.SelectK8sAppName(command.Args().First())
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.WaitK8sDeploymentRollout(ctx, appName); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								return nil
+							},
+						},
+						{
+							Name:      "history",
+							Aliases:   []string{"h"},
+							Usage:     "List the revisions of an app with their change-cause, image and time",
+							ArgsUsage: "[app|cmd]",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:    "output",
+									Aliases: []string{"o"},
+									Usage:   "output format (" + strings.Join(k8s.K8sOutputs, ", ") + ")",
+									Value:   k8s.K8sOutputTable,
+								},
+							},
+							Action: func(ctx context.Context, command *cli.Command) error {
+								if err := k8s.CheckK3dConfig(); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								if err := k8s.CheckK8sOutput(command.String("output")); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								appName, err := k8s.SelectK8sAppName(command.Args().First())
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
 
-								switch selectedKind {
-								case k8s.K8sManifestKindDeployment:
-									tier, err := k8s.SelectK8sDeploymentTier()
-									if err != nil {
-										return cli.Exit(err.Error(), 1)
-									}
+								revisions, err := k8s.ListK8sDeploymentRevisions(ctx, appName)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
 
-									if err := k8s.GenerateK8sDeploymentFile(tier, k8s.GlobalConfig.Namespace, cmds...); err != nil {
-										return cli.Exit(err.Error(), 1)
-									}
+								if err := k8s.PrintK8sRevisions(revisions, command.String("output")); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
 
-									if err := k8s.GenerateK8sServiceFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+								return nil
+							},
+						},
+						{
+							Name:      "undo",
+							Aliases:   []string{"u"},
+							Usage:     "Roll an app back to a previous revision",
+							ArgsUsage: "[app|cmd]",
+							Flags: []cli.Flag{
+								&cli.IntFlag{
+									Name:    "to-revision",
+									Aliases: []string{"r"},
+									Usage:   "revision to roll back to (default: selected from the history)",
+								},
+							},
+							Action: func(ctx context.Context, command *cli.Command) error {
+								if err := k8s.CheckK3dConfig(); err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								appName, err := k8s.SelectK8sAppName(command.Args().First())
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
+
+								revision := command.Int("to-revision")
+								if revision == 0 {
+									revisions, err := k8s.ListK8sDeploymentRevisions(ctx, appName)
+									if err != nil {
 										return cli.Exit(err.Error(), 1)
 									}
-								case k8s.K8sManifestKindCronJob:
-									if err := k8s.GenerateK8sCronJobFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+
+									revision, err = k8s.SelectK8sRevision(revisions)
+									if err != nil {
 										return cli.Exit(err.Error(), 1)
 									}
-								default:
-									log.Printf("Unknown K3D manifest kind: %s", selectedKind)
-									return cli.Exit("Unknown K3D manifest kind", 1)
 								}
 
-								if err := k8s.GenerateK8sConfigMap(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+								if err := k8s.UndoK8sDeployment(ctx, appName, revision); err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								if err := k8s.GenerateK8sPvcFile(k8s.GlobalConfig.Namespace, cmds...); err != nil {
+								if err := k8s.WaitK8sDeploymentRollout(ctx, appName); err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								log.Printf("Created K3D manifest for command: %s", selectedCmd)
+								log.Printf("Rolled %s back to revision %d", appName, revision)
 
 								return nil
 							},
 						},
+					},
+				},
+			},
+		},
+		{
+			Name:      "dev",
+			Aliases:   []string{"d"},
+			Usage:     "Watch a cmd, then rebuild and redeploy it to the K3D cluster on every change",
+			ArgsUsage: "[cmd]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "builder",
+					Aliases: []string{"b"},
+					Usage:   "image builder (" + strings.Join(dev.Builders, ", ") + ")",
+					Value:   dev.BuilderDocker,
+				},
+			},
+			Action: func(ctx context.Context, command *cli.Command) error {
+				if err := k8s.CheckK3dConfig(); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+
+				builder := command.String("builder")
+				if !slices.Contains(dev.Builders, builder) {
+					return cli.Exit("Unknown builder: "+builder, 1)
+				}
+
+				selectedCmd := strings.TrimPrefix(strings.Trim(command.Args().First(), "/"), packages.RootPackageCmd+"/")
+				if selectedCmd == "" {
+					var err error
+					selectedCmd, err = packages.SelectCmdName()
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+				}
+
+				log.Printf("Watching %s, press Ctrl+C to stop", selectedCmd)
+				if err := dev.Run(ctx, dev.Option{
+					Cmd:     selectedCmd,
+					Builder: builder,
+				}); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+
+				return nil
+			},
+		},
+		{
+			Name:    "helm",
+			Aliases: []string{"hm"},
+			Usage:   "Manage Helm charts in the K3D cluster",
+			Commands: []*cli.Command{
+				{
+					Name:    "repo",
+					Aliases: []string{"r"},
+					Usage:   "Manage Helm repositories",
+					Commands: []*cli.Command{
 						{
-							Name:    "build",
-							Aliases: []string{"b", "d", "deploy"},
-							Usage:   "Build cmd and push to local registry",
+							Name:    "add",
+							Aliases: []string{"a"},
+							Usage:   "Add a Helm repository",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								selectedCmd, err := packages.SelectCmdName()
+								name, url, err := k8s.InputHelmRepo()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								cmds := strings.Split(selectedCmd, "/")
-
-								if err := docker.BuildDockerImage(cmds...); err != nil {
+								if err := k8s.AddHelmRepo(name, url); err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								log.Printf("Built K3D manifest for command: %s", selectedCmd)
+								log.Printf("Added Helm repository: %s", name)
+								return nil
+							},
+						},
+						{
+							Name:    "list",
+							Aliases: []string{"ls", "l"},
+							Usage:   "List Helm repositories",
+							Action: func(ctx context.Context, command *cli.Command) error {
+								repos, err := k8s.ListHelmRepos()
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
 
+								repos.Print()
 								return nil
 							},
 						},
 						{
-							Name:    "apply",
-							Aliases: []string{"a"},
-							Usage:   "Apply K3D manifest",
+							Name:    "remove",
+							Aliases: []string{"d", "rm"},
+							Usage:   "Remove a Helm repository",
 							Action: func(ctx context.Context, command *cli.Command) error {
-								selectedManifests, err := k8s.SelectK8sManifest()
+								repos, err := k8s.ListHelmRepos()
 								if err != nil {
 									return cli.Exit(err.Error(), 1)
 								}
 
-								for _, manifest := range selectedManifests {
-									log.Printf("Applied K3D manifest: %s", manifest)
-									if err := k8s.ApplyK8sManifest(manifest); err != nil {
-										return cli.Exit(err.Error(), 1)
-									}
+								repo, err := k8s.SelectHelmRepo(repos)
+								if err != nil {
+									return cli.Exit(err.Error(), 1)
+								}
 
-									log.Printf("Applied K3D manifest successfully")
+								if err := k8s.RemoveHelmRepo(repo.Name); err != nil {
+									return cli.Exit(err.Error(), 1)
 								}
 
+								log.Printf("Removed Helm repository: %s", repo.Name)
 								return nil
 							},
 						},
-						{
-							Name:    "get",
-							Aliases: []string{"g"},
-							Usage:   "Get K3D resources",
-							Commands: []*cli.Command{
-								{
-									Name:    "pods",
-									Aliases: []string{"p", "po"},
-									Usage:   "Get K3D pods",
-									Action: func(ctx context.Context, command *cli.Command) error {
-										if err := k8s.RunK8sGetPods(); err != nil {
-											return cli.Exit(err.Error(), 1)
-										}
+					},
+				},
+				{
+					Name:    "search",
+					Aliases: []string{"s"},
+					Usage:   "Search Helm charts",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "hub",
+							Usage: "search Artifact Hub instead of the added repositories",
+						},
+					},
+					Action: func(ctx context.Context, command *cli.Command) error {
+						query, err := k8s.InputHelmSearchQuery()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-										return nil
-									},
-								},
-								{
-									Name:    "services",
-									Aliases: []string{"s", "svc"},
-									Usage:   "Get K3D services",
-									Action: func(ctx context.Context, command *cli.Command) error {
-										if err := k8s.RunK8sGetServices(); err != nil {
-											return cli.Exit(err.Error(), 1)
-										}
+						charts, err := k8s.SearchHelmChart(k8s.GetHelmSearchSource(command.Bool("hub")), query)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-										return nil
-									},
-								},
-								{
-									Name:    "deployments",
-									Aliases: []string{"d", "deploy"},
-									Usage:   "Get K3D deployments",
-									Action: func(ctx context.Context, command *cli.Command) error {
-										if err := k8s.RunK8sGetDeployments(); err != nil {
-											return cli.Exit(err.Error(), 1)
-										}
+						charts.Print()
+						return nil
+					},
+				},
+				{
+					Name:    "install",
+					Aliases: []string{"i"},
+					Usage:   "Install a Helm chart with values stored under manifests/helm",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{
+							Name:  "hub",
+							Usage: "search Artifact Hub instead of the added repositories",
+						},
+					},
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-										return nil
-									},
-								},
-								{
-									Name:    "ingress",
-									Aliases: []string{"i"},
-									Usage:   "Get K3D ingress",
-									Action: func(ctx context.Context, command *cli.Command) error {
-										if err := k8s.RunK8sGetIngress(); err != nil {
-											return cli.Exit(err.Error(), 1)
-										}
+						query, err := k8s.InputHelmSearchQuery()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
 
-										return nil
-									},
-								},
-							},
-						},
+						chart, err := k8s.SelectHelmChartFromRepo(k8s.GetHelmSearchSource(command.Bool("hub")), query)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						spec := k8s.NewHelmReleaseSpec(chart)
+						release, err := k8s.InputHelmReleaseName(filepath.Base(spec.Chart))
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						valuesPath, err := k8s.WriteHelmValuesFile(spec, release)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := k8s.SaveHelmReleaseSpec(release, spec); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						edit := false
+						if err := survey.AskOne(&survey.Confirm{
+							Message: fmt.Sprintf("Edit %s before installing?", valuesPath),
+							Default: false,
+						}, &edit); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if edit {
+							if err := k8s.EditHelmValuesFile(release); err != nil {
+								return cli.Exit(err.Error(), 1)
+							}
+						}
+
+						if err := k8s.InstallHelmChart(spec, release); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Installed Helm release: %s", release)
+						return nil
+					},
+				},
+				{
+					Name:    "list",
+					Aliases: []string{"ls", "l"},
+					Usage:   "List Helm releases",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						releases, err := k8s.ListHelmReleases()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						releases.Print()
+						return nil
+					},
+				},
+				{
+					Name:    "uninstall",
+					Aliases: []string{"d", "rm"},
+					Usage:   "Uninstall a Helm release",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						releases, err := k8s.ListHelmReleases()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						release, err := k8s.SelectHelmRelease(releases)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := k8s.UninstallHelmChart(release.Name); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Uninstalled Helm release: %s", release.Name)
+						return nil
+					},
+				},
+				{
+					Name:    "upgrade",
+					Aliases: []string{"u"},
+					Usage:   "Upgrade a Helm release with its stored values",
+					Action: func(ctx context.Context, command *cli.Command) error {
+						if err := k8s.CheckK3dConfig(); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						releases, err := k8s.ListHelmReleases()
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						release, err := k8s.SelectHelmRelease(releases)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						spec, err := k8s.LoadHelmReleaseSpec(release.Name)
+						if err != nil {
+							return cli.Exit(fmt.Sprintf("no stored chart for release %s: %s", release.Name, err.Error()), 1)
+						}
+
+						spec.Version, err = k8s.InputHelmChartVersion(spec.Version)
+						if err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if _, err := k8s.WriteHelmValuesFile(spec, release.Name); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := k8s.UpgradeHelmChart(spec, release.Name); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						if err := k8s.SaveHelmReleaseSpec(release.Name, spec); err != nil {
+							return cli.Exit(err.Error(), 1)
+						}
+
+						log.Printf("Upgraded Helm release: %s", release.Name)
+						return nil
 					},
 				},
 			},
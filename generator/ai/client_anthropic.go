@@ -21,21 +21,21 @@ func NewAnthropicClient(apiKey string, model string) (*AnthropicClient, error) {
 	}, nil
 }
 
-func (c *AnthropicClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+func (c *AnthropicClient) generate(ctx context.Context, prompt string, input string, maxTokens int64) (<-chan string, error) {
 	ch := make(chan string, 1)
 	chat, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
-		MaxTokens: 1024,
+		MaxTokens: maxTokens,
 		Messages: []anthropic.MessageParam{
 			{
 				Role: anthropic.MessageParamRoleAssistant,
 				Content: []anthropic.ContentBlockParamUnion{{
-					OfRequestTextBlock: &anthropic.TextBlockParam{Text: CommitMessageGenerationPrompt},
+					OfRequestTextBlock: &anthropic.TextBlockParam{Text: prompt},
 				}},
 			},
 			{
 				Role: anthropic.MessageParamRoleUser,
 				Content: []anthropic.ContentBlockParamUnion{{
-					OfRequestTextBlock: &anthropic.TextBlockParam{Text: gitDiff},
+					OfRequestTextBlock: &anthropic.TextBlockParam{Text: input},
 				}},
 			},
 		},
@@ -47,6 +47,8 @@ func (c *AnthropicClient) GenerateCommitMessage(ctx context.Context, gitDiff str
 	}
 
 	go func() {
+		defer close(ch)
+
 		for _, content := range chat.Content {
 			ch <- content.Text
 		}
@@ -54,3 +56,11 @@ func (c *AnthropicClient) GenerateCommitMessage(ctx context.Context, gitDiff str
 
 	return ch, nil
 }
+
+func (c *AnthropicClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+	return c.generate(ctx, CommitMessageGenerationPrompt, gitDiff, 1024)
+}
+
+func (c *AnthropicClient) GenerateCommitSplit(ctx context.Context, changes string) (<-chan string, error) {
+	return c.generate(ctx, CommitSplitPrompt, changes, 4096)
+}
@@ -29,7 +29,7 @@ func NewGeminiClient(backend genai.Backend, apiKey string, model string, locatio
 	}, nil
 }
 
-func (c *GeminiClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+func (c *GeminiClient) generate(ctx context.Context, prompt string, input string) (<-chan string, error) {
 	ch := make(chan string, 1024)
 	chat, err := c.client.Chats.Create(ctx, c.model, &genai.GenerateContentConfig{
 		Temperature: Wrap(float32(0.75)),
@@ -37,7 +37,7 @@ func (c *GeminiClient) GenerateCommitMessage(ctx context.Context, gitDiff string
 		{
 			Role: genai.RoleUser,
 			Parts: []*genai.Part{
-				genai.NewPartFromText(CommitMessageGenerationPrompt),
+				genai.NewPartFromText(prompt),
 			},
 		},
 	})
@@ -49,7 +49,7 @@ func (c *GeminiClient) GenerateCommitMessage(ctx context.Context, gitDiff string
 	go func() {
 		defer close(ch)
 
-		for part, err := range chat.SendMessageStream(ctx, *genai.NewPartFromText(gitDiff)) {
+		for part, err := range chat.SendMessageStream(ctx, *genai.NewPartFromText(input)) {
 			if err != nil {
 				log.Printf("Error occurred while receiving message: %v", err)
 				return
@@ -65,3 +65,11 @@ func (c *GeminiClient) GenerateCommitMessage(ctx context.Context, gitDiff string
 
 	return ch, nil
 }
+
+func (c *GeminiClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+	return c.generate(ctx, CommitMessageGenerationPrompt, gitDiff)
+}
+
+func (c *GeminiClient) GenerateCommitSplit(ctx context.Context, changes string) (<-chan string, error) {
+	return c.generate(ctx, CommitSplitPrompt, changes)
+}
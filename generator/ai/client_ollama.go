@@ -2,6 +2,7 @@ package ai
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"net/url"
 	"time"
@@ -47,28 +48,35 @@ func (c *OllamaClient) chat(ctx context.Context, system []string, user []string)
 
 	ch := make(chan string, 1024)
 
-	if err := c.client.Chat(ctx, &api.ChatRequest{
-		Model:    c.model,
-		Stream:   Wrap(true),
-		Messages: messages,
-	}, func(response api.ChatResponse) error {
-		if response.Done {
-			close(ch)
+	go func() {
+		defer close(ch)
+
+		if err := c.client.Chat(ctx, &api.ChatRequest{
+			Model:    c.model,
+			Stream:   Wrap(true),
+			Messages: messages,
+		}, func(response api.ChatResponse) error {
+			ch <- response.Message.Content
 			return nil
+		}); err != nil {
+			log.Printf("Error occurred while receiving message: %v", err)
 		}
+	}()
 
-		ch <- response.Message.Content
-		return nil
-	}); err != nil {
-		close(ch)
+	return ch, nil
+}
+
+func (c *OllamaClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+	ch, err := c.chat(ctx, []string{CommitMessageGenerationPrompt}, []string{gitDiff})
+	if err != nil {
 		return nil, err
 	}
 
 	return ch, nil
 }
 
-func (c *OllamaClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
-	ch, err := c.chat(ctx, []string{CommitMessageGenerationPrompt}, []string{gitDiff})
+func (c *OllamaClient) GenerateCommitSplit(ctx context.Context, changes string) (<-chan string, error) {
+	ch, err := c.chat(ctx, []string{CommitSplitPrompt}, []string{changes})
 	if err != nil {
 		return nil, err
 	}
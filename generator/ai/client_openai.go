@@ -21,12 +21,12 @@ func NewOpenAIClient(apiKey string, model string) (*OpenAIClient, error) {
 	}, nil
 }
 
-func (c *OpenAIClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+func (c *OpenAIClient) generate(ctx context.Context, prompt string, input string) (<-chan string, error) {
 	ch := make(chan string, 1)
 	chat, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
 		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(CommitMessageGenerationPrompt),
-			openai.UserMessage(gitDiff),
+			openai.SystemMessage(prompt),
+			openai.UserMessage(input),
 		},
 		Model: c.model,
 	})
@@ -40,3 +40,11 @@ func (c *OpenAIClient) GenerateCommitMessage(ctx context.Context, gitDiff string
 
 	return ch, nil
 }
+
+func (c *OpenAIClient) GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error) {
+	return c.generate(ctx, CommitMessageGenerationPrompt, gitDiff)
+}
+
+func (c *OpenAIClient) GenerateCommitSplit(ctx context.Context, changes string) (<-chan string, error) {
+	return c.generate(ctx, CommitSplitPrompt, changes)
+}
@@ -109,6 +109,7 @@ func InitConfig() error {
 
 type LLMClient interface {
 	GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string, error)
+	GenerateCommitSplit(ctx context.Context, changes string) (<-chan string, error)
 }
 
 func NewLLMClient(ctx context.Context) (LLMClient, error) {
@@ -165,3 +166,17 @@ func GenerateCommitMessage(ctx context.Context, gitDiff string) (<-chan string,
 
 	return ch, nil
 }
+
+func GenerateCommitSplit(ctx context.Context, changes string) (<-chan string, error) {
+	client, err := NewLLMClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := client.GenerateCommitSplit(ctx, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
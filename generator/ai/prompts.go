@@ -76,6 +76,49 @@ func GetCommitMessageOutputFrom(output string) (string, error) {
 	return commitMessage, nil
 }
 
+const (
+	CommitSplitPrompt = `## LLM Prompt: Split Changes into Atomic Conventional Commits
+You are an AI assistant tasked with splitting a set of unrelated changes into several small, atomic commits.
+## Input:
+* Every changed file starts with a line '### File: <path> (<type>)'.
+* Modified files are followed by their hunks, each starting with a line '#### Hunk <number>' and the hunk itself.
+* Other files (new, deleted, renamed, binary) have no hunks and can only be committed as a whole.
+## Rules:
+1.  Group changes that belong to the same logical change into one commit, and keep unrelated changes in separate commits.
+2.  Every file, and every hunk of a modified file, must appear in exactly one commit.
+3.  Hunks of the same file may be placed in different commits when they are unrelated.
+4.  Order the commits so that each commit builds on the previous ones (e.g., a new type before its first use).
+5.  Each commit message must follow the Conventional Commits specification: '<type>[optional scope][!]: <description>'.
+    * '<type>' is one of: feat, fix, build, chore, ci, docs, style, refactor, perf, test.
+    * The description uses the imperative, present tense, begins with a lowercase letter and does not end with a period.
+## Output
+### Output Format:
+<Plan>
+- message: "<commit message>"
+  files:
+    - path: "<path>"
+      hunks: [<hunk number>, ...]
+</Plan>
+### Note:
+* The content between <Plan> and </Plan> must be valid YAML.
+* Omit 'hunks' to commit the whole file.
+* Do not output anything else than the plan.
+`
+)
+
+func GetCommitSplitOutputFrom(output string) (string, error) {
+	s := strings.Index(output, "<Plan>")
+	if s == -1 {
+		return "", fmt.Errorf("no <Plan> tag found in output")
+	}
+	e := strings.Index(output, "</Plan>")
+	if e == -1 {
+		return "", fmt.Errorf("no </Plan> tag found in output")
+	}
+	plan := output[s+6 : e]
+	return plan, nil
+}
+
 const (
 	ArchitecturePrompt = `## LLM Instructions: Package Structure and Name Generation based on 'ako' Project Architecture
 
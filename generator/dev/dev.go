@@ -0,0 +1,294 @@
+package dev
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/gosuda/ako/generator/docker"
+	"github.com/gosuda/ako/generator/k8s"
+	"github.com/gosuda/ako/generator/packages"
+	"github.com/gosuda/ako/util/git"
+)
+
+const (
+	BuilderDocker = "docker"
+	BuilderKo     = "ko"
+)
+
+var Builders = []string{BuilderDocker, BuilderKo}
+
+const (
+	watchInterval = 500 * time.Millisecond
+	// Editors save several files at once, so a change is built once the files stay unchanged for
+	// this long.
+	watchSettle = 300 * time.Millisecond
+	// Lines of the new pods logged before the logs are followed, such as their startup.
+	devLogsTail = 50
+)
+
+type Option struct {
+	// Cmd is the path of the cmd under cmd/, such as api/auth.
+	Cmd     string
+	Builder string
+}
+
+// Run builds and deploys the cmd to the k3d cluster, then rebuilds and redeploys it whenever a
+// package it depends on changes, streaming its logs in between, until interrupted.
+func Run(ctx context.Context, option Option) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	loop := &devLoop{
+		option:   option,
+		cmdDepth: strings.Split(option.Cmd, "/"),
+	}
+	loop.appName = k8s.MakeCmdDepthToName(loop.cmdDepth...)
+
+	set, err := loop.watchSet()
+	if err != nil {
+		return err
+	}
+	fingerprint := set.fingerprint()
+
+	loop.deploy(ctx)
+	defer loop.stopLogs()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopped watching")
+			return nil
+		case <-ticker.C:
+		}
+
+		if set.fingerprint() == fingerprint {
+			continue
+		}
+
+		for {
+			time.Sleep(watchSettle)
+			settled := set.fingerprint()
+			if settled == fingerprint {
+				break
+			}
+			fingerprint = settled
+		}
+
+		// Imports may have changed, so the packages to watch are listed again.
+		if updated, err := loop.watchSet(); err != nil {
+			log.Printf("failed to list the packages of %s: %v", option.Cmd, err)
+		} else {
+			set = updated
+		}
+		fingerprint = set.fingerprint()
+
+		log.Printf("Change detected, rebuilding %s", color.New(color.Bold).Sprint(option.Cmd))
+		loop.deploy(ctx)
+	}
+}
+
+type devLoop struct {
+	option   Option
+	cmdDepth []string
+	appName  string
+
+	logsCancel context.CancelFunc
+	logsDone   sync.WaitGroup
+}
+
+// deploy builds the cmd and rolls its Deployment out. Failures are reported and the loop keeps
+// watching, so the next save can fix them.
+func (l *devLoop) deploy(ctx context.Context) {
+	l.stopLogs()
+
+	started := time.Now()
+	image, err := l.build()
+	if err != nil {
+		log.Printf("%s %v", color.RedString("build failed:"), err)
+		return
+	}
+
+	if err := l.rollout(ctx, image); err != nil {
+		log.Printf("%s %v", color.RedString("deploy failed:"), err)
+		return
+	}
+
+	log.Printf("Deployed %s in %s", color.New(color.Bold).Sprint(image), time.Since(started).Round(time.Second))
+	l.startLogs(ctx)
+}
+
+func (l *devLoop) build() (string, error) {
+	switch l.option.Builder {
+	case BuilderKo:
+		return k8s.BuildKoImageForDev("./"+filepath.ToSlash(filepath.Join(packages.RootPackageCmd, l.option.Cmd)), l.cmdDepth...)
+	default:
+		return docker.BuildDockerImageForDev(l.cmdDepth...)
+	}
+}
+
+func (l *devLoop) rollout(ctx context.Context, image string) error {
+	exists, err := k8s.K8sDeploymentExists(ctx, l.appName)
+	if err != nil {
+		return err
+	}
+
+	// The first run applies the local manifests of the app, so the Deployment exists to patch.
+	if !exists {
+		if err := l.applyManifests(ctx); err != nil {
+			return err
+		}
+	}
+
+	head, err := git.DescribeGitHead()
+	if err != nil {
+		log.Printf("failed to describe the git HEAD: %v", err)
+	}
+	if err := k8s.AnnotateK8sDeploymentChangeCause(ctx, l.appName, k8s.MakeK8sChangeCause("ako dev "+devImageVersion(image), head)); err != nil {
+		return err
+	}
+
+	if err := k8s.SetK8sDeploymentImage(ctx, l.appName, image); err != nil {
+		return err
+	}
+
+	return k8s.WaitK8sDeploymentRollout(ctx, l.appName)
+}
+
+// devImageVersion shortens the digest of an image built by the loop, such as sha256:0123456789ab.
+func devImageVersion(image string) string {
+	_, digest, ok := strings.Cut(image, "@")
+	if !ok {
+		return image[strings.LastIndex(image, ":")+1:]
+	}
+
+	if len(digest) > len("sha256:")+12 {
+		return digest[:len("sha256:")+12]
+	}
+
+	return digest
+}
+
+func (l *devLoop) applyManifests(ctx context.Context) error {
+	files, err := k8s.ResolveK8sManifests("local", l.appName)
+	if err != nil {
+		return fmt.Errorf("%w, run 'ako k3d manifest create' first", err)
+	}
+
+	plan, err := k8s.PlanK8sApply(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	results := k8s.ApplyK8sPlan(ctx, plan)
+	k8s.PrintK8sApplyResults(results)
+	if failures := k8s.CountK8sApplyFailures(results); failures > 0 {
+		return fmt.Errorf("failed to apply %d resources", failures)
+	}
+
+	return nil
+}
+
+func (l *devLoop) startLogs(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	l.logsCancel = cancel
+	l.logsDone.Add(1)
+	go func() {
+		defer l.logsDone.Done()
+		if err := k8s.StreamK8sAppLogs(ctx, l.appName, k8s.K8sLogsOption{Follow: true, Tail: devLogsTail}); err != nil {
+			log.Printf("failed to stream logs of %s: %v", l.appName, err)
+		}
+	}()
+}
+
+func (l *devLoop) stopLogs() {
+	if l.logsCancel == nil {
+		return
+	}
+
+	l.logsCancel()
+	l.logsDone.Wait()
+	l.logsCancel = nil
+}
+
+// watchSet is what a rebuild depends on: the package directories of the module the cmd imports,
+// the module files and, for docker builds, the Dockerfile.
+type watchSet struct {
+	dirs  []string
+	files []string
+}
+
+func (l *devLoop) watchSet() (*watchSet, error) {
+	moduleDir, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list -m: %w", err)
+	}
+	root := strings.TrimSpace(string(moduleDir))
+
+	cmdPath := "./" + filepath.ToSlash(filepath.Join(packages.RootPackageCmd, l.option.Cmd))
+	dirs, err := exec.Command("go", "list", "-e", "-deps", "-f", "{{if not .Standard}}{{.Dir}}{{end}}", cmdPath).Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list -deps %s: %w", cmdPath, err)
+	}
+
+	set := &watchSet{files: []string{filepath.Join(root, "go.mod"), filepath.Join(root, "go.sum")}}
+	if l.option.Builder != BuilderKo {
+		set.files = append(set.files, filepath.Join(root, packages.RootPackageCmd, l.option.Cmd, "Dockerfile"))
+	}
+
+	for _, dir := range strings.Fields(string(dirs)) {
+		// Dependencies outside of the module only change with go.mod and go.sum.
+		if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			set.dirs = append(set.dirs, dir)
+		}
+	}
+
+	return set, nil
+}
+
+// fingerprint hashes the size and modification time of the watched files, so that edited, added
+// and removed files all change it. Tests do not end up in the binary and are left out.
+func (s *watchSet) fingerprint() uint64 {
+	hash := fnv.New64a()
+	write := func(file string) {
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(hash, "%s\x00missing\n", file)
+			return
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+
+	for _, file := range s.files {
+		write(file)
+	}
+
+	for _, dir := range s.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintf(hash, "%s\x00missing\n", dir)
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), "_test.go") {
+				continue
+			}
+			write(filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return hash.Sum64()
+}
@@ -24,8 +24,34 @@ func generateTimeBasedVersion() string {
 	return "v" + fmt.Sprintf("%02d.%02d.%02d", now.Year()%100, now.Month(), now.Day()) + "-eph." + strconv.Itoa(secondsSinceMidnight)
 }
 
-func BuildDockerImage(cmdDepth ...string) error {
+// BuildDockerImage builds the image of the cmd for the local and the remote registry, and returns
+// the version it was tagged with.
+func BuildDockerImage(cmdDepth ...string) (string, error) {
 	version := generateTimeBasedVersion()
+	imageTag, imageTagForLocal, err := buildLocalDockerImage(version, cmdDepth...)
+	if err != nil {
+		return "", err
+	}
+
+	imageTagForRemote := k8s2.GlobalConfig.RemoteRegistry + "/" + imageTag
+
+	log.Printf("Building docker image for remote image %s", color.New(color.Bold).Sprint(imageTagForLocal))
+
+	cmd := exec.Command("docker", "tag", imageTag, imageTagForRemote)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	log.Printf("push image %s yourself, I cannot assist.", color.New(color.Bold).Sprint(imageTagForRemote))
+
+	return version, nil
+}
+
+// buildLocalDockerImage builds the image of the cmd and pushes it to the local registry. It returns
+// the built tag and the tag it was pushed as.
+func buildLocalDockerImage(version string, cmdDepth ...string) (string, string, error) {
 	appName := k8s2.MakeCmdDepthToName(cmdDepth...)
 	imageTag := k8s2.GlobalConfig.Namespace + "/" + appName + ":" + version
 	dockerFilePath := filepath.Join(packages.RootPackageCmd, filepath.Join(cmdDepth...), "Dockerfile")
@@ -33,43 +59,54 @@ func BuildDockerImage(cmdDepth ...string) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return err
+		return "", "", err
 	}
 
 	originImageTagForLocal := k8s2.GlobalConfig.LocalRegistry + "/" + imageTag
 	log.Printf("Building docker image for local image: %s", originImageTagForLocal)
-	sp := strings.Split(k8s2.GlobalConfig.LocalRegistry, ".")
-	imageTagForLocal := sp[len(sp)-1] + "/" + imageTag
+	imageTagForLocal := k8s2.GetLocalRegistryPushHost() + "/" + imageTag
 	log.Printf("Build local image tag: %s", imageTagForLocal)
 
 	cmd = exec.Command("docker", "tag", imageTag, imageTagForLocal)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return err
+		return "", "", err
 	}
 
 	cmd = exec.Command("docker", "push", imageTagForLocal)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return err
+		return "", "", err
 	}
 
 	log.Printf("pushed image to local registry: %s", color.New(color.Bold).Sprint(originImageTagForLocal))
 
-	imageTagForRemote := k8s2.GlobalConfig.RemoteRegistry + "/" + imageTag
+	return imageTag, imageTagForLocal, nil
+}
 
-	log.Printf("Building docker image for remote image %s", color.New(color.Bold).Sprint(imageTagForLocal))
+// BuildDockerImageForDev builds the image of the cmd, pushes it to the local registry and returns
+// the image pinned by digest as pods pull it, so every build rolls the deployment out.
+func BuildDockerImageForDev(cmdDepth ...string) (string, error) {
+	_, imageTagForLocal, err := buildLocalDockerImage(generateTimeBasedVersion(), cmdDepth...)
+	if err != nil {
+		return "", err
+	}
 
-	cmd = exec.Command("docker", "tag", imageTag, imageTagForRemote)
-	cmd.Stdout = os.Stdout
+	cmd := exec.Command("docker", "inspect", "--format", "{{range .RepoDigests}}{{println .}}{{end}}", imageTagForLocal)
 	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return err
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
 	}
 
-	log.Printf("push image %s yourself, I cannot assist.", color.New(color.Bold).Sprint(imageTagForRemote))
+	repository := imageTagForLocal[:strings.LastIndex(imageTagForLocal, ":")]
+	for _, digest := range strings.Fields(string(output)) {
+		if strings.HasPrefix(digest, repository+"@") {
+			return k8s2.GlobalConfig.LocalRegistry + strings.TrimPrefix(digest, k8s2.GetLocalRegistryPushHost()), nil
+		}
+	}
 
-	return nil
+	return "", fmt.Errorf("no digest of %s found after pushing it", imageTagForLocal)
 }
@@ -0,0 +1,649 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gosuda/ako/util/template"
+)
+
+const (
+	helmChartFolder         = "chart"
+	helmChartFileName       = "Chart.yaml"
+	helmSubChartFolder      = "charts"
+	helmTemplateFolder      = "templates"
+	helmChartVersion        = "0.1.0"
+	helmChartAppVersion     = "v1.0.0"
+	helmEnvValuesFilePrefix = "values-"
+)
+
+// Helm chart templates are written as is, they are rendered by helm and not by ako.
+const helmDeploymentTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Chart.Name }}-deployment
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+    tier: {{ .Values.tier }}
+    version: {{ .Chart.AppVersion }}
+  annotations:
+    kubernetes.io/change-cause: {{ .Values.changeCause | quote }}
+spec:
+  {{- if not .Values.autoscaling.enabled }}
+  replicas: {{ .Values.replicaCount }}
+  {{- end }}
+  selector:
+    matchLabels:
+      app: {{ .Chart.Name }}
+  template:
+    metadata:
+      labels:
+        app: {{ .Chart.Name }}
+        tier: {{ .Values.tier }}
+      {{- with .Values.health }}
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: {{ .port | quote }}
+        prometheus.io/path: {{ .metricsPath | quote }}
+      {{- end }}
+    spec:
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+      {{- with .Values.health }}
+      terminationGracePeriodSeconds: {{ .terminationGracePeriodSeconds }}
+      {{- end }}
+      containers:
+      - name: {{ .Chart.Name }}
+        image: "{{ .Values.global.image.registry }}/{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+        imagePullPolicy: {{ .Values.image.pullPolicy }}
+        ports:
+        - name: http
+          containerPort: {{ .Values.port }}
+        {{- with .Values.health }}
+        - name: health
+          containerPort: {{ .port }}
+        startupProbe:
+          httpGet:
+            path: {{ .livenessPath }}
+            port: health
+          periodSeconds: 2
+          failureThreshold: 30
+        livenessProbe:
+          httpGet:
+            path: {{ .livenessPath }}
+            port: health
+          periodSeconds: 10
+          failureThreshold: 3
+        readinessProbe:
+          httpGet:
+            path: {{ .readinessPath }}
+            port: health
+          periodSeconds: 5
+          failureThreshold: 2
+        lifecycle:
+          preStop:
+            exec:
+              command: ["sleep", {{ .preStopSeconds | quote }}]
+        {{- end }}
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+        {{- with .Values.resources }}
+        resources:
+          {{- toYaml . | nindent 10 }}
+        {{- end }}
+        envFrom:
+        - configMapRef:
+            name: {{ .Chart.Name }}-configmap
+        {{- if .Values.persistence.enabled }}
+        volumeMounts:
+        - name: {{ .Chart.Name }}-volume
+          mountPath: {{ .Values.persistence.mountPath }}
+        {{- end }}
+      {{- if .Values.persistence.enabled }}
+      volumes:
+      - name: {{ .Chart.Name }}-volume
+        persistentVolumeClaim:
+          claimName: {{ .Chart.Name }}-pvc
+      {{- end }}
+`
+
+const helmServiceTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Chart.Name }}-service
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+spec:
+  selector:
+    app: {{ .Chart.Name }}
+  ports:
+    - protocol: TCP
+      port: {{ .Values.service.port }}
+      targetPort: {{ .Values.port }}
+  type: {{ .Values.service.type }}
+`
+
+const helmCronJobTemplate = `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: {{ .Chart.Name }}
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+    job-type: cron
+spec:
+  schedule: {{ .Values.schedule | quote }}
+  concurrencyPolicy: {{ .Values.concurrencyPolicy }}
+  successfulJobsHistoryLimit: {{ .Values.successfulJobsHistoryLimit }}
+  failedJobsHistoryLimit: {{ .Values.failedJobsHistoryLimit }}
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: {{ .Chart.Name }}-cronjob
+            image: "{{ .Values.global.image.registry }}/{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+            imagePullPolicy: {{ .Values.image.pullPolicy }}
+            {{- with .Values.args }}
+            args:
+              {{- toYaml . | nindent 14 }}
+            {{- end }}
+            envFrom:
+            - configMapRef:
+                name: {{ .Chart.Name }}-configmap
+          restartPolicy: {{ .Values.restartPolicy }}
+`
+
+const helmConfigMapTemplate = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Chart.Name }}-configmap
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+data:
+  {{- range $key, $value := .Values.config }}
+  {{ $key }}: {{ $value | quote }}
+  {{- end }}
+`
+
+const helmPvcTemplate = `{{- if .Values.persistence.enabled }}
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: {{ .Chart.Name }}-pvc
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+spec:
+  accessModes:
+    - {{ .Values.persistence.accessMode }}
+  resources:
+    requests:
+      storage: {{ .Values.persistence.size }}
+  {{- with .Values.persistence.storageClassName }}
+  storageClassName: {{ . }}
+  {{- end }}
+{{- end }}
+`
+
+const helmHPATemplate = `{{- if .Values.autoscaling.enabled }}
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{ .Chart.Name }}-hpa
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+    tier: {{ .Values.tier }}
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: {{ .Chart.Name }}-deployment
+  minReplicas: {{ .Values.autoscaling.minReplicas }}
+  maxReplicas: {{ .Values.autoscaling.maxReplicas }}
+  metrics:
+  {{- with .Values.autoscaling.metric }}
+  {{- if eq .type "cpu" }}
+  - type: Resource
+    resource:
+      name: cpu
+      target:
+        type: Utilization
+        averageUtilization: {{ .cpuUtilization }}
+  {{- else }}
+  - type: Pods
+    pods:
+      metric:
+        name: {{ .name }}
+      target:
+        type: AverageValue
+        averageValue: {{ .averageValue | quote }}
+  {{- end }}
+  {{- end }}
+{{- end }}
+`
+
+const helmPDBTemplate = `{{- if .Values.podDisruptionBudget.enabled }}
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Chart.Name }}-pdb
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+spec:
+  maxUnavailable: {{ .Values.podDisruptionBudget.maxUnavailable }}
+  selector:
+    matchLabels:
+      app: {{ .Chart.Name }}
+{{- end }}
+`
+
+const helmNetworkPolicyTemplate = `{{- if .Values.networkPolicy.enabled }}
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: {{ .Chart.Name }}-networkpolicy
+  namespace: {{ .Release.Namespace }}
+  labels:
+    app: {{ .Chart.Name }}
+    tier: {{ .Values.tier }}
+  annotations:
+    description: {{ .Values.networkPolicy.description | quote }}
+spec:
+  podSelector:
+    matchLabels:
+      app: {{ .Chart.Name }}
+  policyTypes:
+  - Ingress
+  ingress:
+  {{- if eq .Values.networkPolicy.ingress "all" }}
+  - ports:
+    - port: http
+  {{- else if eq .Values.networkPolicy.ingress "namespace" }}
+  - from:
+    - podSelector: {}
+    ports:
+    - port: http
+  {{- else if eq .Values.networkPolicy.ingress "tiers" }}
+  - from:
+    - podSelector:
+        matchExpressions:
+        - key: tier
+          operator: In
+          values:
+          {{- toYaml .Values.networkPolicy.fromTiers | nindent 10 }}
+    ports:
+    - port: http
+  {{- end }}
+  - from:
+    - namespaceSelector: {}
+    ports:
+    - port: health
+{{- end }}
+`
+
+const helmSubChartValuesTemplate = `# Default values of {{ .AppName }}. Environment specific values are set in the umbrella chart's values-<env>.yaml.
+global:
+  image:
+    registry: {{ .Registry }}
+
+image:
+  repository: {{ .Namespace }}/{{ .AppName }}
+  tag: latest
+  pullPolicy: Always
+
+config:
+  key: value
+  loopback: 127.0.0.1
+
+persistence:
+  enabled: false
+  accessMode: ReadWriteOnce
+  size: 1Gi
+  storageClassName: standard
+  mountPath: /data
+{{- if eq .Kind "deployment" }}
+
+tier: {{ .Tier }}
+changeCause: Initial deployment
+replicaCount: {{ .Replicas }}
+port: 8080
+
+service:
+  type: ClusterIP
+  port: 80
+
+# Served by the health module of the cmd (pkg/health).
+health:
+  port: {{ .Health.Port }}
+  livenessPath: {{ .Health.LivenessPath }}
+  readinessPath: {{ .Health.ReadinessPath }}
+  metricsPath: {{ .Health.MetricsPath }}
+  preStopSeconds: {{ .Health.PreStopSeconds }}
+  terminationGracePeriodSeconds: {{ .Health.TerminationGracePeriodSeconds }}
+
+resources:
+  requests:
+    memory: 256Mi
+    cpu: 500m
+  limits:
+    memory: 1Gi
+    cpu: "1"
+
+# Policies selected when the chart was created are enabled, the others can be enabled here.
+autoscaling:
+  enabled: {{ .Autoscaling }}
+  minReplicas: {{ .HPA.MinReplicas }}
+  maxReplicas: {{ .HPA.MaxReplicas }}
+  metric:
+    type: {{ .HPA.Metric.Type }}
+    {{- if eq .HPA.Metric.Type "cpu" }}
+    cpuUtilization: {{ .HPA.Metric.CPUUtilization }}
+    {{- else }}
+    name: {{ .HPA.Metric.Name }}
+    averageValue: {{ quote .HPA.Metric.AverageValue }}
+    {{- end }}
+
+podDisruptionBudget:
+  enabled: {{ .PodDisruptionBudget }}
+  maxUnavailable: {{ .PDB.MaxUnavailable }}
+
+networkPolicy:
+  enabled: {{ .NetworkPolicy }}
+  description: {{ quote .Network.Description }}
+  ingress: {{ .Network.Ingress }}
+  {{- if .Network.FromTiers }}
+  fromTiers:
+  {{- range .Network.FromTiers }}
+  - {{ . }}
+  {{- end }}
+  {{- else }}
+  fromTiers: []
+  {{- end }}
+{{- else }}
+
+schedule: "*/5 * * * *"
+args: []
+restartPolicy: OnFailure
+concurrencyPolicy: Forbid
+successfulJobsHistoryLimit: 3
+failedJobsHistoryLimit: 1
+{{- end }}
+`
+
+type helmSubChartValuesData struct {
+	AppName             string
+	Namespace           string
+	Kind                string
+	Tier                string
+	Registry            string
+	Replicas            int
+	Health              *K8sHealth
+	Autoscaling         bool
+	HPA                 K8sHPAData
+	PodDisruptionBudget bool
+	PDB                 K8sPDBData
+	NetworkPolicy       bool
+	Network             K8sNetworkPolicyData
+}
+
+type HelmChartDependency struct {
+	Name      string `yaml:"name"`
+	Version   string `yaml:"version"`
+	Condition string `yaml:"condition,omitempty"`
+}
+
+type HelmChart struct {
+	APIVersion   string                `yaml:"apiVersion"`
+	Name         string                `yaml:"name"`
+	Description  string                `yaml:"description,omitempty"`
+	Type         string                `yaml:"type,omitempty"`
+	Version      string                `yaml:"version"`
+	AppVersion   string                `yaml:"appVersion,omitempty"`
+	Dependencies []HelmChartDependency `yaml:"dependencies,omitempty"`
+}
+
+func getHelmChartFolder() string {
+	return filepath.Join(k8sManifestFolder, helmChartFolder)
+}
+
+func getHelmEnvValuesPath(env string) string {
+	return filepath.Join(getHelmChartFolder(), helmEnvValuesFilePrefix+env+".yaml")
+}
+
+func readYamlFile(path string, out any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+func writeYamlFile(path string, in any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := yaml.NewEncoder(f)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(in); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+// setYamlValue sets values[keys[0]][keys[1]]... = value, creating the intermediate maps.
+func setYamlValue(values map[string]any, value any, keys ...string) {
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := values[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			values[key] = next
+		}
+		values = next
+	}
+
+	values[keys[len(keys)-1]] = value
+}
+
+// updateHelmValuesFile loads a values file, or starts an empty one, and writes it back after update.
+func updateHelmValuesFile(path string, update func(values map[string]any)) error {
+	values := map[string]any{}
+	if err := readYamlFile(path, &values); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	update(values)
+
+	return writeYamlFile(path, values)
+}
+
+// addHelmUmbrellaDependency creates the umbrella chart of the namespace if needed and adds the subchart to it.
+func addHelmUmbrellaDependency(namespace string, appName string) error {
+	chartPath := filepath.Join(getHelmChartFolder(), helmChartFileName)
+	chart := HelmChart{
+		APIVersion:  "v2",
+		Name:        namespace,
+		Description: "Umbrella chart of the " + namespace + " namespace",
+		Type:        "application",
+		Version:     helmChartVersion,
+		AppVersion:  helmChartAppVersion,
+	}
+	if err := readYamlFile(chartPath, &chart); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if !slices.ContainsFunc(chart.Dependencies, func(d HelmChartDependency) bool { return d.Name == appName }) {
+		chart.Dependencies = append(chart.Dependencies, HelmChartDependency{
+			Name:      appName,
+			Version:   helmChartVersion,
+			Condition: appName + ".enabled",
+		})
+	}
+
+	return writeYamlFile(chartPath, chart)
+}
+
+// GenerateHelmChart writes a subchart for the cmd into the namespace's umbrella chart under
+// manifests/chart, and registers it in the values of every environment. The image registry of
+// each environment comes from the k3d config. Deployments get templates for every policy, the
+// selected ones are enabled in the values.
+func GenerateHelmChart(kind string, tier string, policies []string, metric *K8sHPAMetric, namespace string, cmdDepth ...string) error {
+	if kind != K8sManifestKindDeployment && kind != K8sManifestKindCronJob {
+		return fmt.Errorf("helm chart is not supported for %s yet, use raw manifests or --kustomize", kind)
+	}
+
+	appName := MakeCmdDepthToName(cmdDepth...)
+	subChartFolder := filepath.Join(getHelmChartFolder(), helmSubChartFolder, appName)
+	if err := os.MkdirAll(filepath.Join(subChartFolder, helmTemplateFolder), 0755); err != nil {
+		return err
+	}
+
+	if err := writeYamlFile(filepath.Join(subChartFolder, helmChartFileName), HelmChart{
+		APIVersion: "v2",
+		Name:       appName,
+		Type:       "application",
+		Version:    helmChartVersion,
+		AppVersion: helmChartAppVersion,
+	}); err != nil {
+		return err
+	}
+
+	autoscaled := slices.Contains(policies, K8sPolicyHPA)
+	values := helmSubChartValuesData{
+		AppName:             appName,
+		Namespace:           namespace,
+		Kind:                kind,
+		Tier:                tier,
+		Registry:            GlobalConfig.RemoteRegistry,
+		Replicas:            getK8sTierPolicy(tier).Replicas,
+		Health:              newK8sHealth(),
+		Autoscaling:         autoscaled,
+		PodDisruptionBudget: slices.Contains(policies, K8sPolicyPDB),
+		PDB:                 newK8sPDBData(namespace, appName),
+		NetworkPolicy:       slices.Contains(policies, K8sPolicyNetworkPolicy),
+		Network:             newK8sNetworkPolicyData(tier, namespace, appName),
+	}
+	if kind == K8sManifestKindDeployment {
+		if metric == nil {
+			metric = &K8sHPAMetric{Type: k8sHPAMetricCPU, CPUUtilization: getK8sTierPolicy(tier).CPUUtilization}
+		}
+
+		hpa, err := newK8sHPAData(kind, tier, metric, namespace, appName)
+		if err != nil {
+			return err
+		}
+		values.HPA = hpa
+	}
+
+	if err := template.WriteTemplate2File(filepath.Join(subChartFolder, "values.yaml"), helmSubChartValuesTemplate, values); err != nil {
+		return err
+	}
+
+	templates := map[string]string{
+		k8sConfigMapFile: helmConfigMapTemplate,
+		k8sPvcFile:       helmPvcTemplate,
+	}
+	switch kind {
+	case K8sManifestKindDeployment:
+		templates[k8sDeploymentFile] = helmDeploymentTemplate
+		templates[k8sServiceFile] = helmServiceTemplate
+		templates[k8sHpaFile] = helmHPATemplate
+		templates[k8sPdbFile] = helmPDBTemplate
+		templates[k8sNetworkPolicyFile] = helmNetworkPolicyTemplate
+	case K8sManifestKindCronJob:
+		templates[k8sCronJobFile] = helmCronJobTemplate
+	}
+
+	for name, content := range templates {
+		if err := os.WriteFile(filepath.Join(subChartFolder, helmTemplateFolder, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := addHelmUmbrellaDependency(namespace, appName); err != nil {
+		return err
+	}
+
+	if err := updateHelmValuesFile(filepath.Join(getHelmChartFolder(), "values.yaml"), func(values map[string]any) {
+		setYamlValue(values, GlobalConfig.RemoteRegistry, "global", "image", "registry")
+		setYamlValue(values, true, appName, "enabled")
+	}); err != nil {
+		return err
+	}
+
+	localMinReplicas, localMaxReplicas := getK8sLocalHPAReplicas(tier)
+	envs := map[string]struct {
+		registry    string
+		replicas    int
+		minReplicas int
+		maxReplicas int
+	}{
+		k8sEnvLocal:  {registry: GlobalConfig.LocalRegistry, replicas: 1, minReplicas: localMinReplicas, maxReplicas: localMaxReplicas},
+		k8sEnvRemote: {registry: GlobalConfig.RemoteRegistry, replicas: getK8sTierPolicy(tier).Replicas, minReplicas: getK8sTierPolicy(tier).MinReplicas, maxReplicas: getK8sTierPolicy(tier).MaxReplicas},
+	}
+	for env, config := range envs {
+		if err := updateHelmValuesFile(getHelmEnvValuesPath(env), func(values map[string]any) {
+			setYamlValue(values, config.registry, "global", "image", "registry")
+			if kind == K8sManifestKindDeployment {
+				setYamlValue(values, config.replicas, appName, "replicaCount")
+			}
+			if autoscaled {
+				setYamlValue(values, config.minReplicas, appName, "autoscaling", "minReplicas")
+				setYamlValue(values, config.maxReplicas, appName, "autoscaling", "maxReplicas")
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetHelmChartBuild points the local values of the cmd's subchart at the image of the built version,
+// as SetK8sDeploymentBuild does for the raw manifest. It reports false when the cmd has no subchart.
+func SetHelmChartBuild(version string, changeCause string, cmdDepth ...string) (bool, error) {
+	appName := MakeCmdDepthToName(cmdDepth...)
+	if _, err := os.Stat(filepath.Join(getHelmChartFolder(), helmSubChartFolder, appName)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := updateHelmValuesFile(getHelmEnvValuesPath(k8sEnvLocal), func(values map[string]any) {
+		setYamlValue(values, version, appName, "image", "tag")
+		setYamlValue(values, changeCause, appName, "changeCause")
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -8,11 +8,14 @@ import (
 	"path/filepath"
 
 	"github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
 
 	"github.com/gosuda/ako/util/table"
 )
 
 type HelmSearchItem struct {
+	// Name is set by 'helm search repo' as '<repo>/<chart>'. 'helm search hub' sets URL and Repository instead.
+	Name        string `json:"name"`
 	URL         string `json:"url"`
 	Version     string `json:"version"`
 	AppVersion  string `json:"app_version"`
@@ -23,12 +26,22 @@ type HelmSearchItem struct {
 	} `json:"repository"`
 }
 
+// Chart returns the chart reference and, for hub charts, the repository URL to pass with --repo.
+func (item HelmSearchItem) Chart() (string, string) {
+	if item.Name != "" {
+		return item.Name, ""
+	}
+
+	return filepath.Base(item.URL), item.Repository.URL
+}
+
 type HelmSearchResult []HelmSearchItem
 
 func (result HelmSearchResult) Print() {
 	tbl := table.NewTableBuilder("Name", "URL", "Version", "AppVersion", "Description", "Repository URL", "Repository Name")
 	for _, item := range result {
-		tbl.AppendRow(filepath.Base(item.URL), item.URL, item.Version, item.AppVersion, item.Description, item.Repository.URL, item.Repository.Name)
+		chart, _ := item.Chart()
+		tbl.AppendRow(chart, item.URL, item.Version, item.AppVersion, item.Description, item.Repository.URL, item.Repository.Name)
 	}
 	tbl.Print()
 }
@@ -47,6 +60,10 @@ func searchHelmChart(repo string, query string) (HelmSearchResult, error) {
 	return result, nil
 }
 
+func SearchHelmChart(repo string, query string) (HelmSearchResult, error) {
+	return searchHelmChart(repo, query)
+}
+
 func SelectHelmChartFromRepo(repo string, query string) (HelmSearchItem, error) {
 	charts, err := searchHelmChart(repo, query)
 	if err != nil {
@@ -59,7 +76,8 @@ func SelectHelmChartFromRepo(repo string, query string) (HelmSearchItem, error)
 
 	candidates := make([]string, len(charts))
 	for i, chart := range charts {
-		candidates[i] = fmt.Sprintf("%s: %s => %s", filepath.Base(chart.URL), chart.Version, chart.Description)
+		name, _ := chart.Chart()
+		candidates[i] = fmt.Sprintf("%s: %s => %s", name, chart.Version, chart.Description)
 	}
 
 	var selectedName string
@@ -86,8 +104,20 @@ func SelectHelmChartFromRepo(repo string, query string) (HelmSearchItem, error)
 	return selectedChart, nil
 }
 
-func InstallHelmChart(chart HelmSearchItem, releaseName string, namespace string) error {
-	cmd := exec.Command("helm", "install", releaseName, filepath.Base(chart.URL), "--repo", chart.Repository.URL, "--namespace", namespace)
+func InstallHelmChart(spec HelmReleaseSpec, releaseName string) error {
+	return runHelmRelease("install", spec, releaseName)
+}
+
+func UpgradeHelmChart(spec HelmReleaseSpec, releaseName string) error {
+	return runHelmRelease("upgrade", spec, releaseName)
+}
+
+func runHelmRelease(action string, spec HelmReleaseSpec, releaseName string) error {
+	args := []string{action, releaseName, spec.Chart, "-f", getHelmValuesPath(releaseName)}
+	args = append(args, spec.chartArgs()...)
+	args = append(args, helmScopeArgs()...)
+
+	cmd := exec.Command("helm", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err := cmd.Run()
@@ -109,8 +139,17 @@ type HelmReleaseListItem struct {
 
 type HelmReleaseListResult []HelmReleaseListItem
 
-func ListHelmReleases(namespace string) (HelmReleaseListResult, error) {
-	output, err := exec.Command("helm", "list", "--namespace", namespace, "-o", "json").Output()
+func (result HelmReleaseListResult) Print() {
+	tbl := table.NewTableBuilder("Name", "Namespace", "Revision", "Updated", "Status", "Chart", "AppVersion")
+	for _, item := range result {
+		tbl.AppendRow(item.Name, item.Namespace, item.Revision, item.Updated, item.Status, item.Chart, item.AppVersion)
+	}
+	tbl.Print()
+}
+
+func ListHelmReleases() (HelmReleaseListResult, error) {
+	args := append([]string{"list", "-o", "json"}, helmScopeArgs()...)
+	output, err := exec.Command("helm", args...).Output()
 	if err != nil {
 		return nil, err
 	}
@@ -157,8 +196,9 @@ func SelectHelmRelease(releases HelmReleaseListResult) (HelmReleaseListItem, err
 	return selectedRelease, nil
 }
 
-func UninstallHelmChart(releaseName string, namespace string) error {
-	cmd := exec.Command("helm", "uninstall", releaseName, "--namespace", namespace)
+func UninstallHelmChart(releaseName string) error {
+	args := append([]string{"uninstall", releaseName}, helmScopeArgs()...)
+	cmd := exec.Command("helm", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	err := cmd.Run()
@@ -246,3 +286,200 @@ func RemoveHelmRepo(name string) error {
 	}
 	return nil
 }
+
+const (
+	helmManifestFolder   = "helm"
+	helmValuesFileName   = "values.yaml"
+	helmReleaseFileName  = "release.yaml"
+	helmSearchSourceRepo = "repo"
+	helmSearchSourceHub  = "hub"
+)
+
+// HelmReleaseSpec records where the chart of a release comes from, next to its values file,
+// so that the release can be reproduced.
+type HelmReleaseSpec struct {
+	Chart      string `yaml:"chart"`
+	Repository string `yaml:"repository,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+}
+
+func NewHelmReleaseSpec(chart HelmSearchItem) HelmReleaseSpec {
+	name, repository := chart.Chart()
+	return HelmReleaseSpec{
+		Chart:      name,
+		Repository: repository,
+		Version:    chart.Version,
+	}
+}
+
+func (spec HelmReleaseSpec) chartArgs() []string {
+	args := make([]string, 0, 4)
+	if spec.Repository != "" {
+		args = append(args, "--repo", spec.Repository)
+	}
+	if spec.Version != "" {
+		args = append(args, "--version", spec.Version)
+	}
+	return args
+}
+
+func GetHelmSearchSource(hub bool) string {
+	if hub {
+		return helmSearchSourceHub
+	}
+
+	return helmSearchSourceRepo
+}
+
+// helmScopeArgs scopes a helm command to the k3d cluster and namespace of the manifests.
+func helmScopeArgs() []string {
+	return []string{"--kube-context", K3dClusterPrefix + GlobalConfig.Cluster, "--namespace", GlobalConfig.Namespace}
+}
+
+func getHelmReleaseFolder(releaseName string) string {
+	return filepath.Join(k8sManifestFolder, helmManifestFolder, releaseName)
+}
+
+func getHelmValuesPath(releaseName string) string {
+	return filepath.Join(getHelmReleaseFolder(releaseName), helmValuesFileName)
+}
+
+func InputHelmReleaseName(defaultName string) (string, error) {
+	name := ""
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the release name",
+		Default: defaultName,
+	}, &name, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func InputHelmSearchQuery() (string, error) {
+	query := ""
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the chart to search for",
+	}, &query, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	return query, nil
+}
+
+func InputHelmChartVersion(current string) (string, error) {
+	version := ""
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the chart version (empty for latest)",
+		Default: current,
+	}, &version); err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+func InputHelmRepo() (string, string, error) {
+	answers := struct {
+		Name string
+		URL  string
+	}{}
+	if err := survey.Ask([]*survey.Question{
+		{
+			Name:     "name",
+			Prompt:   &survey.Input{Message: "Enter the repo name"},
+			Validate: survey.Required,
+		},
+		{
+			Name:     "url",
+			Prompt:   &survey.Input{Message: "Enter the repo URL"},
+			Validate: survey.Required,
+		},
+	}, &answers); err != nil {
+		return "", "", err
+	}
+
+	return answers.Name, answers.URL, nil
+}
+
+func LoadHelmReleaseSpec(releaseName string) (HelmReleaseSpec, error) {
+	spec := HelmReleaseSpec{}
+	f, err := os.Open(filepath.Join(getHelmReleaseFolder(releaseName), helmReleaseFileName))
+	if err != nil {
+		return spec, err
+	}
+	defer f.Close()
+
+	if err := yaml.NewDecoder(f).Decode(&spec); err != nil {
+		return spec, err
+	}
+
+	return spec, nil
+}
+
+func SaveHelmReleaseSpec(releaseName string, spec HelmReleaseSpec) error {
+	if err := os.MkdirAll(getHelmReleaseFolder(releaseName), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(getHelmReleaseFolder(releaseName), helmReleaseFileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := yaml.NewEncoder(f).Encode(spec); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WriteHelmValuesFile writes the chart's default values to the release's values file, unless the
+// file already exists so that local edits are kept.
+func WriteHelmValuesFile(spec HelmReleaseSpec, releaseName string) (string, error) {
+	path := getHelmValuesPath(releaseName)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(getHelmReleaseFolder(releaseName), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	args := append([]string{"show", "values", spec.Chart}, spec.chartArgs()...)
+	output, err := exec.Command("helm", args...).Output()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path, output, 0o644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+func EditHelmValuesFile(releaseName string) error {
+	path := getHelmValuesPath(releaseName)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	edited := ""
+	if err := survey.AskOne(&survey.Editor{
+		Message:       "Edit values",
+		Default:       string(content),
+		AppendDefault: true,
+		FileName:      "*.yaml",
+	}, &edited); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		return err
+	}
+
+	return nil
+}
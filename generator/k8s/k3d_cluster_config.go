@@ -0,0 +1,315 @@
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	k3dClusterConfigFileName   = ".ako/k3d_cluster.yaml"
+	k3dClusterConfigAPIVersion = "k3d.io/v1alpha5"
+	k3dClusterConfigKind       = "Simple"
+)
+
+const (
+	k3dNodeFilterLoadBalancer = "loadbalancer"
+	k3dNodeFilterServers      = "server:*"
+	k3dNodeFilterAll          = "all"
+)
+
+// K3dComponents are the packaged components of k3s a cluster can go without, such as traefik when
+// another ingress controller serves the routes.
+var K3dComponents = []string{"traefik", "servicelb", "metrics-server", "local-storage"}
+
+// K3dClusterConfig is the part of a k3d Simple config that ako writes and reconciles. k3d reads the
+// whole file, so fields added by hand, such as options.k3d.wait, still apply to the cluster.
+type K3dClusterConfig struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Servers    int                      `yaml:"servers"`
+	Agents     int                      `yaml:"agents"`
+	Image      string                   `yaml:"image,omitempty"`
+	Ports      []K3dClusterConfigFilter `yaml:"ports,omitempty"`
+	Volumes    []K3dClusterConfigFilter `yaml:"volumes,omitempty"`
+	Registries struct {
+		Use []string `yaml:"use,omitempty"`
+	} `yaml:"registries,omitempty"`
+	Options struct {
+		K3s struct {
+			ExtraArgs []K3dClusterConfigFilter `yaml:"extraArgs,omitempty"`
+		} `yaml:"k3s,omitempty"`
+	} `yaml:"options,omitempty"`
+}
+
+// K3dClusterConfigFilter is a port, volume or k3s argument, and the nodes it applies to. Only the
+// field of its kind is set.
+type K3dClusterConfigFilter struct {
+	Port        string   `yaml:"port,omitempty"`
+	Volume      string   `yaml:"volume,omitempty"`
+	Arg         string   `yaml:"arg,omitempty"`
+	NodeFilters []string `yaml:"nodeFilters,omitempty"`
+}
+
+func GetK3dClusterConfigPath() string {
+	return filepath.Join(k8sManifestFolder, k3dClusterConfigFileName)
+}
+
+func K3dClusterConfigExists() bool {
+	_, err := os.Stat(GetK3dClusterConfigPath())
+	return err == nil
+}
+
+func makeK3dPort(hostPort int, containerPort int) string {
+	return fmt.Sprintf("%d:%d", hostPort, containerPort)
+}
+
+// NewK3dClusterConfig describes a cluster with a server, the agents, the load balancer ports and
+// volumes mounted into every node, using the registry and running k3s without the components.
+func NewK3dClusterConfig(name string, agents int, registry string, loadBalancerPortMap map[int]int, volumes []string, disabledComponents []string) *K3dClusterConfig {
+	config := &K3dClusterConfig{
+		APIVersion: k3dClusterConfigAPIVersion,
+		Kind:       k3dClusterConfigKind,
+		Servers:    1,
+		Agents:     agents,
+	}
+	config.Metadata.Name = name
+
+	for _, hostPort := range slices.Sorted(maps.Keys(loadBalancerPortMap)) {
+		config.Ports = append(config.Ports, K3dClusterConfigFilter{
+			Port:        makeK3dPort(hostPort, loadBalancerPortMap[hostPort]),
+			NodeFilters: []string{k3dNodeFilterLoadBalancer},
+		})
+	}
+
+	for _, volume := range volumes {
+		config.Volumes = append(config.Volumes, K3dClusterConfigFilter{Volume: volume, NodeFilters: []string{k3dNodeFilterAll}})
+	}
+
+	if registry != "" {
+		config.Registries.Use = []string{registry}
+	}
+
+	for _, component := range disabledComponents {
+		config.Options.K3s.ExtraArgs = append(config.Options.K3s.ExtraArgs, K3dClusterConfigFilter{
+			Arg:         "--disable=" + component,
+			NodeFilters: []string{k3dNodeFilterServers},
+		})
+	}
+
+	return config
+}
+
+func SaveK3dClusterConfig(config *K3dClusterConfig) error {
+	if err := os.MkdirAll(filepath.Dir(GetK3dClusterConfigPath()), os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := os.Create(GetK3dClusterConfigPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := yaml.NewEncoder(f)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func LoadK3dClusterConfig() (*K3dClusterConfig, error) {
+	f, err := os.Open(GetK3dClusterConfigPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("k3d cluster config not found, run 'ako k3d cluster create' first")
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	config := &K3dClusterConfig{}
+	if err := yaml.NewDecoder(f).Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %w", GetK3dClusterConfigPath(), err)
+	}
+
+	if config.Kind != k3dClusterConfigKind || config.Metadata.Name == "" {
+		return nil, fmt.Errorf("%s is not a k3d %s config with a cluster name", GetK3dClusterConfigPath(), k3dClusterConfigKind)
+	}
+
+	return config, nil
+}
+
+func InputK3dClusterVolumes() ([]string, error) {
+	input := ""
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the volumes to mount into every node (hostPath:containerPath, comma separated, empty for none)",
+	}, &input); err != nil {
+		return nil, err
+	}
+
+	volumes := make([]string, 0)
+	for _, volume := range strings.Split(input, ",") {
+		volume = strings.TrimSpace(volume)
+		if volume == "" {
+			continue
+		}
+
+		if !strings.Contains(volume, ":") {
+			return nil, fmt.Errorf("invalid volume: %s", volume)
+		}
+		volumes = append(volumes, volume)
+	}
+
+	return volumes, nil
+}
+
+func SelectK3dDisabledComponents() ([]string, error) {
+	disabled := make([]string, 0)
+	if err := survey.AskOne(&survey.MultiSelect{
+		Message: "Select the k3s components to disable",
+		Options: K3dComponents,
+		Help:    "Use space to select, enter to confirm",
+	}, &disabled); err != nil {
+		return nil, err
+	}
+
+	return disabled, nil
+}
+
+// UpK3dCluster creates the cluster of the config, or brings the running one up to date with it.
+// k3d edits only the load balancer ports of a running cluster, so other differences are reported,
+// to be applied by recreating the cluster.
+func UpK3dCluster() error {
+	config, err := LoadK3dClusterConfig()
+	if err != nil {
+		return err
+	}
+
+	clusters, err := GetK3dClusters()
+	if err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(clusters, func(cluster K3dClusterInfo) bool {
+		return cluster.Name == config.Metadata.Name
+	})
+	if index < 0 {
+		if err := CreateK3dCluster(); err != nil {
+			return err
+		}
+
+		log.Printf("Created K3D cluster: %s", config.Metadata.Name)
+		return nil
+	}
+	cluster := clusters[index]
+
+	livePorts := make([]string, 0)
+	for _, node := range cluster.Nodes {
+		if node.Role != k3dNodeFilterLoadBalancer {
+			continue
+		}
+
+		for containerPort, bindings := range node.PortMappings {
+			containerPort, _, _ = strings.Cut(containerPort, "/")
+			for _, binding := range bindings {
+				livePorts = append(livePorts, binding.HostPort+":"+containerPort)
+			}
+		}
+	}
+
+	added := 0
+	for _, port := range config.Ports {
+		if len(port.NodeFilters) > 0 && !slices.Contains(port.NodeFilters, k3dNodeFilterLoadBalancer) {
+			continue
+		}
+
+		mapping, ok := parseK3dPort(port.Port)
+		if !ok || slices.Contains(livePorts, mapping) {
+			continue
+		}
+
+		if err := addK3dClusterPort(cluster.Name, port.Port); err != nil {
+			return err
+		}
+		added++
+	}
+
+	if cluster.ServersCount != config.Servers || cluster.AgentsCount != config.Agents {
+		log.Printf("%s has %d servers and %d agents, but the config asks for %d and %d. Recreate it to apply them: ako k3d cluster delete && ako k3d cluster up",
+			cluster.Name, cluster.ServersCount, cluster.AgentsCount, config.Servers, config.Agents)
+	}
+
+	log.Printf("Added %d ports to K3D cluster %s. Volumes, registries and k3s args apply when the cluster is created", added, cluster.Name)
+
+	return nil
+}
+
+// parseK3dPort returns the host and container port of a port such as 8080:80 or
+// 127.0.0.1:8080:80/tcp, and false when it leaves the host port to docker.
+func parseK3dPort(port string) (string, bool) {
+	port, _, _ = strings.Cut(port, "/")
+	parts := strings.Split(port, ":")
+	if len(parts) < 2 {
+		return "", false
+	}
+
+	for _, part := range parts[len(parts)-2:] {
+		if _, err := strconv.Atoi(part); err != nil {
+			return "", false
+		}
+	}
+
+	return parts[len(parts)-2] + ":" + parts[len(parts)-1], true
+}
+
+// RecordK3dClusterPorts adds the load balancer ports to the config of the cluster, so recreating it
+// keeps them. It reports false when the cluster was not created from the config.
+func RecordK3dClusterPorts(name string, loadBalancerPortMap map[int]int) (bool, error) {
+	path := GetK3dClusterConfigPath()
+	documents, err := loadYamlDocuments(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if len(documents) == 0 || yamlString(yamlRoot(documents[0]), "metadata", "name") != name {
+		return false, nil
+	}
+
+	ports := yamlEnsure(yamlRoot(documents[0]), yaml.SequenceNode, "ports")
+	for _, hostPort := range slices.Sorted(maps.Keys(loadBalancerPortMap)) {
+		port := makeK3dPort(hostPort, loadBalancerPortMap[hostPort])
+		item, err := yamlNodeOf(K3dClusterConfigFilter{Port: port, NodeFilters: []string{k3dNodeFilterLoadBalancer}})
+		if err != nil {
+			return false, err
+		}
+
+		// A host port is bound once, so a new mapping of it replaces the old one.
+		upsertYamlItem(ports, item, func(existing *yaml.Node) bool {
+			mapping, ok := parseK3dPort(yamlString(existing, "port"))
+			return ok && strings.HasPrefix(mapping, strconv.Itoa(hostPort)+":")
+		})
+	}
+
+	if err := writeYamlDocuments(path, documents); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -293,12 +293,9 @@ func InputK3dClusterLoadBalancerPortMap() (map[int]int, error) {
 	return loadBalancerPortMap, nil
 }
 
-func CreateK3dCluster(name string, agents int, registry string, loadBalancerPortMap map[int]int) error {
-	args := []string{"cluster", "create", name, "--registry-use", registry, "--agents", fmt.Sprintf("%d", agents)}
-	for hostPort, containerPort := range loadBalancerPortMap {
-		args = append(args, "-p", fmt.Sprintf("%d:%d@loadbalancer", hostPort, containerPort))
-	}
-	cmd := exec.Command("k3d", args...)
+// CreateK3dCluster creates the cluster described by the k3d config of the project.
+func CreateK3dCluster() error {
+	cmd := exec.Command("k3d", "cluster", "create", "--config", GetK3dClusterConfigPath())
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -309,7 +306,11 @@ func CreateK3dCluster(name string, agents int, registry string, loadBalancerPort
 }
 
 func AddK3dClusterPort(name string, hostPort int, containerPort int) error {
-	cmd := exec.Command("k3d", "cluster", "edit", name, "--port-add", fmt.Sprintf("%d:%d@loadbalancer", hostPort, containerPort))
+	return addK3dClusterPort(name, makeK3dPort(hostPort, containerPort))
+}
+
+func addK3dClusterPort(name string, port string) error {
+	cmd := exec.Command("k3d", "cluster", "edit", name, "--port-add", port+"@"+k3dNodeFilterLoadBalancer)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
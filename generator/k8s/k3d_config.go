@@ -1,8 +1,10 @@
 package k8s
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -53,6 +55,21 @@ func isNotExistsK3dConfig() bool {
 	return false
 }
 
+func CheckK3dConfig() error {
+	if isNotExistsK3dConfig() {
+		return fmt.Errorf("k3d config not found, run 'ako k3d manifest init' first")
+	}
+
+	return nil
+}
+
+// GetLocalRegistryPushHost returns the address images are pushed to the local registry at. Pods pull
+// them from GlobalConfig.LocalRegistry, which resolves only inside the cluster.
+func GetLocalRegistryPushHost() string {
+	sp := strings.Split(GlobalConfig.LocalRegistry, ".")
+	return sp[len(sp)-1]
+}
+
 func SaveK3dConfig() error {
 	if err := os.MkdirAll(k8sManifestFolder, os.ModePerm); err != nil {
 		return err
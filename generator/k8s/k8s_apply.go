@@ -0,0 +1,477 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/pmezard/go-difflib/difflib"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+const (
+	K8sApplyActionCreated    = "created"
+	K8sApplyActionConfigured = "configured"
+	K8sApplyActionUnchanged  = "unchanged"
+	K8sApplyActionFailed     = "failed"
+)
+
+// k8sApplyOrder ranks kinds so that what a resource refers to exists before it: namespaces, then
+// the config and storage workloads mount, then the workloads, the services in front of them and
+// finally the routes to those services. Unknown kinds, such as custom resources, come last.
+var k8sApplyOrder = map[string]int{
+	"Namespace":               0,
+	"ServiceAccount":          1,
+	"ConfigMap":               1,
+	"Secret":                  1,
+	"ExternalSecret":          1,
+	"PersistentVolumeClaim":   1,
+	"Deployment":              2,
+	"StatefulSet":             2,
+	"DaemonSet":               2,
+	"Job":                     2,
+	"CronJob":                 2,
+	"Service":                 3,
+	"HorizontalPodAutoscaler": 3,
+	"PodDisruptionBudget":     3,
+	"NetworkPolicy":           3,
+	"Ingress":                 4,
+	"Gateway":                 4,
+	"HTTPRoute":               4,
+	"IngressRoute":            4,
+}
+
+func k8sApplyRank(kind string) int {
+	if rank, ok := k8sApplyOrder[kind]; ok {
+		return rank
+	}
+
+	return len(k8sApplyOrder)
+}
+
+// ResolveK8sManifests expands the targets into manifest files. A target is a manifest file, a
+// directory, either as given or under manifests/, or an app name such as auth-api. Directories and
+// apps only contribute the manifests of the env, plus those shared by every env.
+func ResolveK8sManifests(env string, targets ...string) ([]string, error) {
+	if env != k8sEnvLocal && env != k8sEnvRemote {
+		return nil, fmt.Errorf("unknown env %s, expected %s or %s", env, k8sEnvLocal, k8sEnvRemote)
+	}
+
+	all, err := GetK8sManifestList(k8sManifestFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	add := func(file string) {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	addOfEnv := func(file string) {
+		for _, other := range []string{k8sEnvLocal, k8sEnvRemote} {
+			if other != env && strings.HasPrefix(filepath.Base(file), other+"-") {
+				return
+			}
+		}
+		add(file)
+	}
+
+	for _, target := range targets {
+		target = filepath.ToSlash(filepath.Clean(target))
+		if info, err := os.Stat(target); err == nil && !info.IsDir() {
+			add(target)
+			continue
+		}
+
+		dir := strings.TrimPrefix(strings.TrimPrefix(target, k8sManifestFolder), "/")
+		matched := false
+		for _, file := range all {
+			switch {
+			case file == dir:
+				add(filepath.Join(k8sManifestFolder, file))
+			case dir == "" || strings.HasPrefix(file, dir+"/") ||
+				MakeCmdDepthToName(strings.Split(filepath.Dir(file), "/")...) == target:
+				addOfEnv(filepath.Join(k8sManifestFolder, file))
+			default:
+				continue
+			}
+			matched = true
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("no manifests found for %s", target)
+		}
+	}
+
+	return files, nil
+}
+
+type K8sApplyChange struct {
+	File      string
+	Kind      string
+	Name      string
+	Namespace string
+	Action    string
+	Message   string
+	object    *unstructured.Unstructured
+	// live and planned are the resource in the cluster, nil when it does not exist, and as the
+	// dry run of the apply left it.
+	live    *unstructured.Unstructured
+	planned *unstructured.Unstructured
+	// autoscaled is set when an HPA scales the resource, which is then applied without replicas.
+	autoscaled bool
+}
+
+func (c K8sApplyChange) Resource() string {
+	return c.Kind + "/" + c.Name
+}
+
+type K8sApplyPlan struct {
+	Changes []K8sApplyChange
+}
+
+func (p *K8sApplyPlan) count(action string) int {
+	count := 0
+	for _, change := range p.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Pending reports whether applying the plan changes anything.
+func (p *K8sApplyPlan) Pending() bool {
+	return slices.ContainsFunc(p.Changes, func(change K8sApplyChange) bool {
+		return change.Action != K8sApplyActionUnchanged
+	})
+}
+
+var k8sNamespaceNotFound = regexp.MustCompile(`namespaces "([^"]+)" not found`)
+
+// PlanK8sApply splits the manifests into resources in dependency order, and finds out with a
+// server-side dry run of a server-side apply which of them would be created, changed or left
+// unchanged.
+func PlanK8sApply(ctx context.Context, files []string) (*K8sApplyPlan, error) {
+	plan := &K8sApplyPlan{}
+	for _, file := range files {
+		objects, err := loadK8sObjects(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		for _, object := range objects {
+			change := K8sApplyChange{
+				File:      file,
+				Kind:      object.kind,
+				Name:      object.name,
+				Namespace: object.namespace,
+				object:    &unstructured.Unstructured{},
+			}
+			if err := change.object.UnmarshalJSON(object.raw); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", file, change.Resource(), err)
+			}
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+
+	return planK8sChanges(ctx, plan)
+}
+
+// planK8sChanges puts the changes of the plan in dependency order and dry runs each of them.
+func planK8sChanges(ctx context.Context, plan *K8sApplyPlan) (*K8sApplyPlan, error) {
+	slices.SortStableFunc(plan.Changes, func(a, b K8sApplyChange) int {
+		return k8sApplyRank(a.Kind) - k8sApplyRank(b.Kind)
+	})
+
+	client, err := getK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := markK8sAutoscaled(ctx, client, plan); err != nil {
+		return nil, err
+	}
+
+	createdNamespaces := make([]string, 0)
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if err := planK8sChange(ctx, client, change); err != nil {
+			// Resources of a namespace created by the same apply cannot be dry run before it exists.
+			if match := k8sNamespaceNotFound.FindStringSubmatch(err.Error()); match != nil && slices.Contains(createdNamespaces, match[1]) {
+				change.Action = K8sApplyActionCreated
+				continue
+			}
+
+			change.Action, change.Message = K8sApplyActionFailed, err.Error()
+			continue
+		}
+
+		if change.Kind == "Namespace" && change.Action == K8sApplyActionCreated {
+			createdNamespaces = append(createdNamespaces, change.Name)
+		}
+	}
+
+	return plan, nil
+}
+
+func planK8sChange(ctx context.Context, client *k8sClient, change *K8sApplyChange) error {
+	resource, err := client.resource(change.object)
+	if err != nil {
+		return err
+	}
+
+	live, err := resource.Get(ctx, change.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	planned, err := client.apply(ctx, change.object, true)
+	if err != nil {
+		return err
+	}
+
+	// The replicas ako still owns are handed over before the apply, which keeps them as they are.
+	if change.autoscaled && live != nil && k8sOwnsReplicas(live) {
+		if replicas, ok, _ := unstructured.NestedFieldCopy(live.Object, "spec", "replicas"); ok {
+			if err := unstructured.SetNestedField(planned.Object, replicas, "spec", "replicas"); err != nil {
+				return err
+			}
+		}
+	}
+
+	change.live, change.planned = live, planned
+	switch {
+	case live == nil:
+		change.Action = K8sApplyActionCreated
+	case reflect.DeepEqual(k8sComparable(live), k8sComparable(planned)):
+		change.Action = K8sApplyActionUnchanged
+	default:
+		change.Action = K8sApplyActionConfigured
+	}
+
+	return nil
+}
+
+// markK8sAutoscaled marks the workloads that an HPA of the plan or of the cluster scales, and leaves
+// their replicas out of the apply, so that ako does not take the field back from the HPA.
+func markK8sAutoscaled(ctx context.Context, client *k8sClient, plan *K8sApplyPlan) error {
+	targets := make([]string, 0)
+	namespaces := make([]string, 0)
+	for _, change := range plan.Changes {
+		namespace := change.Namespace
+		if namespace == "" {
+			namespace = GlobalConfig.Namespace
+		}
+
+		if !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+
+		if change.Kind == "HorizontalPodAutoscaler" {
+			kind, _, _ := unstructured.NestedString(change.object.Object, "spec", "scaleTargetRef", "kind")
+			name, _, _ := unstructured.NestedString(change.object.Object, "spec", "scaleTargetRef", "name")
+			targets = append(targets, namespace+"/"+kind+"/"+name)
+		}
+	}
+
+	for _, namespace := range namespaces {
+		hpas, err := client.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, hpa := range hpas.Items {
+			targets = append(targets, namespace+"/"+hpa.Spec.ScaleTargetRef.Kind+"/"+hpa.Spec.ScaleTargetRef.Name)
+		}
+	}
+
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		namespace := change.Namespace
+		if namespace == "" {
+			namespace = GlobalConfig.Namespace
+		}
+
+		if slices.Contains(targets, namespace+"/"+change.Kind+"/"+change.Name) {
+			change.autoscaled = true
+			unstructured.RemoveNestedField(change.object.Object, "spec", "replicas")
+		}
+	}
+
+	return nil
+}
+
+// k8sOwnsReplicas reports whether ako owns the replicas of the live resource, from an apply made
+// before an HPA scaled it.
+func k8sOwnsReplicas(live *unstructured.Unstructured) bool {
+	for _, entry := range live.GetManagedFields() {
+		if entry.Manager != k8sFieldManager || entry.Operation != metav1.ManagedFieldsOperationApply || entry.FieldsV1 == nil {
+			continue
+		}
+
+		var fields map[string]map[string]any
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+
+		if _, ok := fields["f:spec"]["f:replicas"]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// k8sComparable leaves out of the object the metadata that the server changes on every write, so
+// that two versions of it are equal when their content is.
+func k8sComparable(object *unstructured.Unstructured) map[string]any {
+	object = object.DeepCopy()
+	unstructured.RemoveNestedField(object.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(object.Object, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(object.Object, "metadata", "generation")
+
+	return object.Object
+}
+
+// PrintK8sApplyPlan prints the changes of the plan, followed by the diff of the changed resources
+// when diff is set.
+func PrintK8sApplyPlan(plan *K8sApplyPlan, diff bool) error {
+	for _, change := range plan.Changes {
+		line := fmt.Sprintf("%s (%s)", change.Resource(), change.File)
+		switch change.Action {
+		case K8sApplyActionCreated:
+			fmt.Println(color.GreenString("+ %s", line))
+		case K8sApplyActionConfigured:
+			fmt.Println(color.YellowString("~ %s", line))
+		case K8sApplyActionUnchanged:
+			fmt.Println(color.New(color.Faint).Sprintf("= %s", line))
+		default:
+			fmt.Println(color.RedString("! %s: %s", line, change.Message))
+		}
+	}
+
+	fmt.Printf("\n%s to create, %s to change, %d unchanged, %s failed\n",
+		color.GreenString("%d", plan.count(K8sApplyActionCreated)),
+		color.YellowString("%d", plan.count(K8sApplyActionConfigured)),
+		plan.count(K8sApplyActionUnchanged),
+		color.RedString("%d", plan.count(K8sApplyActionFailed)))
+
+	if !diff {
+		return nil
+	}
+
+	for _, change := range plan.Changes {
+		if change.Action != K8sApplyActionConfigured {
+			continue
+		}
+
+		fmt.Println(color.New(color.Bold).Sprintf("\n%s (%s)", change.Resource(), change.File))
+		if err := printK8sDiff(change.live, change.planned); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// printK8sDiff prints the unified diff of the live resource and the planned one as YAML.
+func printK8sDiff(live *unstructured.Unstructured, planned *unstructured.Unstructured) error {
+	liveYaml, err := sigsyaml.Marshal(k8sComparable(live))
+	if err != nil {
+		return err
+	}
+
+	plannedYaml, err := sigsyaml.Marshal(k8sComparable(planned))
+	if err != nil {
+		return err
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(liveYaml)),
+		B:        difflib.SplitLines(string(plannedYaml)),
+		FromFile: "live",
+		ToFile:   "planned",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Print(color.New(color.Bold).Sprint(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Print(color.GreenString("%s", line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Print(color.RedString("%s", line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Print(color.CyanString("%s", line))
+		default:
+			fmt.Print(line)
+		}
+	}
+
+	return nil
+}
+
+// ApplyK8sPlan applies the resources of the plan server-side one at a time in its order, skipping
+// unchanged ones. A failure does not stop the others, and is reported in the returned changes.
+func ApplyK8sPlan(ctx context.Context, plan *K8sApplyPlan) []K8sApplyChange {
+	results := make([]K8sApplyChange, 0, len(plan.Changes))
+	client, clientErr := getK8sClient()
+	for _, change := range plan.Changes {
+		if change.Action == K8sApplyActionUnchanged {
+			results = append(results, change)
+			continue
+		}
+
+		err := clientErr
+		if err == nil && change.autoscaled && change.live != nil && k8sOwnsReplicas(change.live) {
+			err = client.handoverReplicas(ctx, change.live)
+		}
+		if err == nil {
+			_, err = client.apply(ctx, change.object, false)
+		}
+
+		switch {
+		case err != nil:
+			change.Action, change.Message = K8sApplyActionFailed, err.Error()
+		case change.live == nil:
+			change.Action, change.Message = K8sApplyActionCreated, ""
+		default:
+			change.Action, change.Message = K8sApplyActionConfigured, ""
+		}
+		results = append(results, change)
+	}
+
+	return results
+}
+
+func CountK8sApplyFailures(results []K8sApplyChange) int {
+	plan := K8sApplyPlan{Changes: results}
+	return plan.count(K8sApplyActionFailed)
+}
+
+func PrintK8sApplyResults(results []K8sApplyChange) {
+	tbl := table.NewTableBuilder("RESOURCE", "NAMESPACE", "FILE", "RESULT", "MESSAGE")
+	for _, result := range results {
+		tbl.AppendRow(result.Resource(), result.Namespace, result.File, result.Action, result.Message)
+	}
+	tbl.Print()
+}
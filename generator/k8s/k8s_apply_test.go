@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestK8sApplyChange(kind string, name string, spec map[string]any) K8sApplyChange {
+	return K8sApplyChange{
+		Kind: kind,
+		Name: name,
+		object: &unstructured.Unstructured{Object: map[string]any{
+			"kind":     kind,
+			"metadata": map[string]any{"name": name},
+			"spec":     spec,
+		}},
+	}
+}
+
+func TestMarkK8sAutoscaled(t *testing.T) {
+	GlobalConfig = K3dConfig{Cluster: "test", Namespace: "test"}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-hpa", Namespace: "test"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "StatefulSet", Name: "worker-statefulset"},
+		},
+	}
+	client := &k8sClient{clientset: fake.NewClientset(hpa)}
+
+	plan := &K8sApplyPlan{Changes: []K8sApplyChange{
+		newTestK8sApplyChange("Deployment", "api-deployment", map[string]any{"replicas": int64(2)}),
+		newTestK8sApplyChange("HorizontalPodAutoscaler", "api-hpa", map[string]any{
+			"scaleTargetRef": map[string]any{"kind": "Deployment", "name": "api-deployment"},
+		}),
+		newTestK8sApplyChange("StatefulSet", "worker-statefulset", map[string]any{"replicas": int64(3)}),
+		newTestK8sApplyChange("Deployment", "web-deployment", map[string]any{"replicas": int64(1)}),
+	}}
+
+	if err := markK8sAutoscaled(context.Background(), client, plan); err != nil {
+		t.Fatalf("Failed to mark autoscaled workloads: %v", err)
+	}
+
+	for i, autoscaled := range []bool{true, false, true, false} {
+		change := plan.Changes[i]
+		_, hasReplicas, _ := unstructured.NestedFieldNoCopy(change.object.Object, "spec", "replicas")
+		if change.autoscaled != autoscaled || (change.Kind != "HorizontalPodAutoscaler" && hasReplicas == autoscaled) {
+			t.Errorf("%s: autoscaled %v with replicas %v, expected autoscaled %v", change.Resource(), change.autoscaled, hasReplicas, autoscaled)
+		}
+	}
+}
+
+func TestK8sOwnsReplicas(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]any{}}
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: k8sFieldManager, Operation: metav1.ManagedFieldsOperationApply, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:template":{}}}`)}},
+		{Manager: "kube-controller-manager", Operation: metav1.ManagedFieldsOperationUpdate, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)}},
+	})
+	if k8sOwnsReplicas(live) {
+		t.Errorf("Expected the replicas scaled by the HPA not to be owned by ako")
+	}
+
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{
+		{Manager: k8sFieldManager, Operation: metav1.ManagedFieldsOperationApply, FieldsV1: &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{},"f:template":{}}}`)}},
+	})
+	if !k8sOwnsReplicas(live) {
+		t.Errorf("Expected the applied replicas to be owned by ako")
+	}
+}
@@ -0,0 +1,140 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// k8sFieldManager owns the fields ako applies, so that server-side apply tells them apart from the
+// fields set by others, such as an HPA scaling the replicas.
+const k8sFieldManager = "ako"
+
+// k8sHandoverFieldManager takes the replicas over from ako once an HPA scales a workload, so that
+// leaving them out of ako's apply does not reset them to the default.
+const k8sHandoverFieldManager = "ako-handover"
+
+type k8sClient struct {
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	mapper    meta.RESTMapper
+	// config is what exec and port-forward upgrade their connections with.
+	config *rest.Config
+}
+
+var (
+	k8sClientMu     sync.Mutex
+	k8sClientCached *k8sClient
+)
+
+// getK8sClient connects to the k3d cluster of the manifests through the kubeconfig context k3d
+// wrote for it, once per run.
+func getK8sClient() (*k8sClient, error) {
+	k8sClientMu.Lock()
+	defer k8sClientMu.Unlock()
+
+	if k8sClientCached != nil {
+		return k8sClientCached, nil
+	}
+
+	kubeContext := K3dClusterPrefix + GlobalConfig.Cluster
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig context %s: %w", kubeContext, err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	k8sClientCached = &k8sClient{
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		mapper:    restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+		config:    config,
+	}
+
+	return k8sClientCached, nil
+}
+
+// resource returns the client of the object's resource, in its namespace or else the one of the
+// manifests when the resource is namespaced.
+func (c *k8sClient) resource(object *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := object.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource), nil
+	}
+
+	namespace := object.GetNamespace()
+	if namespace == "" {
+		namespace = GlobalConfig.Namespace
+	}
+
+	return c.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// apply applies the object server-side. Conflicts are forced, since the manifests are the source of
+// truth for the fields they set, even those last changed with kubectl.
+func (c *k8sClient) apply(ctx context.Context, object *unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error) {
+	resource, err := c.resource(object)
+	if err != nil {
+		return nil, err
+	}
+
+	options := metav1.ApplyOptions{FieldManager: k8sFieldManager, Force: true}
+	if dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+
+	return resource.Apply(ctx, object.GetName(), object, options)
+}
+
+// handoverReplicas gives the ownership of the live resource's replicas to k8sHandoverFieldManager,
+// at their current value.
+func (c *k8sClient) handoverReplicas(ctx context.Context, live *unstructured.Unstructured) error {
+	replicas, ok, err := unstructured.NestedFieldCopy(live.Object, "spec", "replicas")
+	if err != nil || !ok {
+		return err
+	}
+
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(live.GetAPIVersion())
+	object.SetKind(live.GetKind())
+	object.SetName(live.GetName())
+	object.SetNamespace(live.GetNamespace())
+	if err := unstructured.SetNestedField(object.Object, replicas, "spec", "replicas"); err != nil {
+		return err
+	}
+
+	resource, err := c.resource(object)
+	if err != nil {
+		return err
+	}
+
+	_, err = resource.Apply(ctx, object.GetName(), object, metav1.ApplyOptions{FieldManager: k8sHandoverFieldManager, Force: true})
+	return err
+}
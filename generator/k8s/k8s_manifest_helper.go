@@ -1,14 +1,26 @@
 package k8s
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"maps"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/gosuda/ako/util/table"
 )
 
 func MakeCmdDepthToName(cmd ...string) string {
@@ -23,6 +35,8 @@ func MakeCmdDepthToName(cmd ...string) string {
 	return fmt.Sprintf("%s-%s", MakeCmdDepthToName(cmd[1:]...), cmd[0])
 }
 
+var k8sManifestSkipFolders = []string{helmChartFolder, helmManifestFolder, kustomizeBaseFolder, kustomizeOverlayFolder, ".ako"}
+
 func GetK8sManifestList(prefix string) ([]string, error) {
 	if prefix == "" {
 		prefix = k8sManifestFolder
@@ -37,6 +51,11 @@ func GetK8sManifestList(prefix string) ([]string, error) {
 
 	for _, entry := range dir {
 		if entry.IsDir() {
+			// Helm charts and kustomize layouts are deployed as a whole, not applied file by file.
+			if prefix == k8sManifestFolder && slices.Contains(k8sManifestSkipFolders, entry.Name()) {
+				continue
+			}
+
 			entries, err := GetK8sManifestList(filepath.Join(prefix, entry.Name()))
 			if err != nil {
 				return nil, err
@@ -97,57 +116,228 @@ func SelectK8sManifest() ([]string, error) {
 	return selected, nil
 }
 
-func ApplyK8sManifest(file string) error {
-	cmd := exec.Command("kubectl", "apply", "-f", file, "--context", K3dClusterPrefix+GlobalConfig.Cluster)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+// ApplyK8sManifest applies the resources of the manifest file server-side in dependency order.
+func ApplyK8sManifest(ctx context.Context, file string) error {
+	plan, err := PlanK8sApply(ctx, []string{file})
+	if err != nil {
 		return err
 	}
 
+	results := ApplyK8sPlan(ctx, plan)
+	PrintK8sApplyResults(results)
+	if failures := CountK8sApplyFailures(results); failures > 0 {
+		return fmt.Errorf("failed to apply %d resources of %s", failures, file)
+	}
+
 	return nil
 }
 
-func RunK8sGetPods() error {
-	cmd := exec.Command("kubectl", "get", "pods", "--context", K3dClusterPrefix+GlobalConfig.Cluster, "-n", GlobalConfig.Namespace, "-o", "wide")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+// printK8sList prints a typed list as JSON or YAML, with the kind and apiVersion of the list and
+// its items filled in as kubectl does, since typed clients leave them out.
+func printK8sList(output string, list runtime.Object) error {
+	items, err := meta.ExtractList(list)
+	if err != nil {
 		return err
 	}
 
+	for _, object := range append(items, list) {
+		if gvks, _, err := scheme.Scheme.ObjectKinds(object); err == nil && len(gvks) > 0 {
+			object.GetObjectKind().SetGroupVersionKind(gvks[0])
+		}
+	}
+
+	return printK8sStructured(output, list)
+}
+
+func k8sAge(timestamp metav1.Time) string {
+	return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
+func k8sNone(values []string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+
+	return strings.Join(values, ",")
+}
+
+// k8sPodStatus is the status of the pod as kubectl shows it, such as CrashLoopBackOff rather than
+// the Running phase of a pod whose container keeps restarting.
+func k8sPodStatus(pod *corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		switch {
+		case status.State.Waiting != nil && status.State.Waiting.Reason != "":
+			return status.State.Waiting.Reason
+		case status.State.Terminated != nil && status.State.Terminated.Reason != "" && pod.Status.Phase == corev1.PodRunning:
+			return status.State.Terminated.Reason
+		}
+	}
+
+	if pod.Status.Reason != "" {
+		return pod.Status.Reason
+	}
+
+	return string(pod.Status.Phase)
+}
+
+func RunK8sGetPods(ctx context.Context, output string) error {
+	client, err := getK8sClient()
+	if err != nil {
+		return err
+	}
+
+	pods, err := client.clientset.CoreV1().Pods(GlobalConfig.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if output != K8sOutputTable {
+		return printK8sList(output, pods)
+	}
+
+	tbl := table.NewTableBuilder("NAME", "READY", "STATUS", "RESTARTS", "AGE", "IP", "NODE")
+	for _, pod := range pods.Items {
+		ready, restarts := 0, int32(0)
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Ready {
+				ready++
+			}
+			restarts += status.RestartCount
+		}
+		tbl.AppendRow(pod.Name, fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)), k8sPodStatus(&pod), strconv.Itoa(int(restarts)), k8sAge(pod.CreationTimestamp), pod.Status.PodIP, pod.Spec.NodeName)
+	}
+	tbl.Print()
+
 	return nil
 }
 
-func RunK8sGetServices() error {
-	cmd := exec.Command("kubectl", "get", "services", "--context", K3dClusterPrefix+GlobalConfig.Cluster, "-n", GlobalConfig.Namespace, "-o", "wide")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+func RunK8sGetServices(ctx context.Context, output string) error {
+	client, err := getK8sClient()
+	if err != nil {
 		return err
 	}
 
+	services, err := client.clientset.CoreV1().Services(GlobalConfig.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if output != K8sOutputTable {
+		return printK8sList(output, services)
+	}
+
+	tbl := table.NewTableBuilder("NAME", "TYPE", "CLUSTER-IP", "EXTERNAL-IP", "PORT(S)", "AGE", "SELECTOR")
+	for _, service := range services.Items {
+		externalIPs := slices.Clone(service.Spec.ExternalIPs)
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			externalIPs = append(externalIPs, cmp.Or(ingress.IP, ingress.Hostname))
+		}
+		externalIP := k8sNone(externalIPs)
+		if len(externalIPs) == 0 && service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			externalIP = "<pending>"
+		}
+
+		ports := make([]string, 0, len(service.Spec.Ports))
+		for _, port := range service.Spec.Ports {
+			if port.NodePort != 0 {
+				ports = append(ports, fmt.Sprintf("%d:%d/%s", port.Port, port.NodePort, port.Protocol))
+				continue
+			}
+			ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		}
+
+		selector := make([]string, 0, len(service.Spec.Selector))
+		for _, key := range slices.Sorted(maps.Keys(service.Spec.Selector)) {
+			selector = append(selector, key+"="+service.Spec.Selector[key])
+		}
+
+		tbl.AppendRow(service.Name, string(service.Spec.Type), service.Spec.ClusterIP, externalIP, k8sNone(ports), k8sAge(service.CreationTimestamp), k8sNone(selector))
+	}
+	tbl.Print()
+
 	return nil
 }
 
-func RunK8sGetDeployments() error {
-	cmd := exec.Command("kubectl", "get", "deployments", "--context", K3dClusterPrefix+GlobalConfig.Cluster, "-n", GlobalConfig.Namespace, "-o", "wide")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+func RunK8sGetDeployments(ctx context.Context, output string) error {
+	client, err := getK8sClient()
+	if err != nil {
 		return err
 	}
 
+	deployments, err := client.clientset.AppsV1().Deployments(GlobalConfig.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if output != K8sOutputTable {
+		return printK8sList(output, deployments)
+	}
+
+	tbl := table.NewTableBuilder("NAME", "READY", "UP-TO-DATE", "AVAILABLE", "AGE", "CONTAINERS", "IMAGES", "SELECTOR")
+	for _, deployment := range deployments.Items {
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+
+		containers := make([]string, 0, len(deployment.Spec.Template.Spec.Containers))
+		images := make([]string, 0, len(deployment.Spec.Template.Spec.Containers))
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			containers = append(containers, container.Name)
+			images = append(images, container.Image)
+		}
+
+		tbl.AppendRow(deployment.Name, fmt.Sprintf("%d/%d", deployment.Status.ReadyReplicas, replicas), strconv.Itoa(int(deployment.Status.UpdatedReplicas)), strconv.Itoa(int(deployment.Status.AvailableReplicas)), k8sAge(deployment.CreationTimestamp), k8sNone(containers), k8sNone(images), metav1.FormatLabelSelector(deployment.Spec.Selector))
+	}
+	tbl.Print()
+
 	return nil
 }
 
-func RunK8sGetIngress() error {
-	cmd := exec.Command("kubectl", "get", "ingress", "--context", K3dClusterPrefix+GlobalConfig.Cluster, "-n", GlobalConfig.Namespace, "-o", "wide")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+func RunK8sGetIngress(ctx context.Context, output string) error {
+	client, err := getK8sClient()
+	if err != nil {
 		return err
 	}
 
+	ingresses, err := client.clientset.NetworkingV1().Ingresses(GlobalConfig.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	if output != K8sOutputTable {
+		return printK8sList(output, ingresses)
+	}
+
+	tbl := table.NewTableBuilder("NAME", "CLASS", "HOSTS", "ADDRESS", "PORTS", "AGE")
+	for _, ingress := range ingresses.Items {
+		class := "<none>"
+		if ingress.Spec.IngressClassName != nil {
+			class = *ingress.Spec.IngressClassName
+		}
+
+		hosts := make([]string, 0, len(ingress.Spec.Rules))
+		for _, rule := range ingress.Spec.Rules {
+			hosts = append(hosts, cmp.Or(rule.Host, "*"))
+		}
+
+		addresses := make([]string, 0, len(ingress.Status.LoadBalancer.Ingress))
+		for _, address := range ingress.Status.LoadBalancer.Ingress {
+			addresses = append(addresses, cmp.Or(address.IP, address.Hostname))
+		}
+
+		ports := "80"
+		if len(ingress.Spec.TLS) > 0 {
+			ports = "80, 443"
+		}
+
+		tbl.AppendRow(ingress.Name, class, k8sNone(hosts), strings.Join(addresses, ","), ports, k8sAge(ingress.CreationTimestamp))
+	}
+	tbl.Print()
+
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 
+	"github.com/gosuda/ako/generator/packages"
 	"github.com/gosuda/ako/util/template"
 )
 
@@ -16,33 +17,38 @@ const (
 )
 
 const (
-	k8sManifestFolder  = "manifests"
-	k8sNamespaceFile   = "namespace.yaml"
-	k8sDeploymentFile  = "deployment.yaml"
-	k8sServiceFile     = "service.yaml"
-	k8sIngressFile     = "ingress.yaml"
-	k8sCronJobFile     = "cronjob.yaml"
-	k8sPvcFile         = "pvc.yaml"
-	k8sConfigMapFile   = "configmap.yaml"
-	k8sSecretFile      = "secret.yaml"
-	k8sJobFile         = "job.yaml"
-	k8sStatefulSetFile = "statefulset.yaml"
-	k8sDaemonSetFile   = "daemonset.yaml"
-	k8sReplicaSetFile  = "replicaset.yaml"
+	k8sManifestFolder     = "manifests"
+	k8sNamespaceFile      = "namespace.yaml"
+	k8sDeploymentFile     = "deployment.yaml"
+	k8sServiceFile        = "service.yaml"
+	k8sIngressFile        = "ingress.yaml"
+	k8sCronJobFile        = "cronjob.yaml"
+	k8sPvcFile            = "pvc.yaml"
+	k8sConfigMapFile      = "configmap.yaml"
+	k8sSecretFile         = "secret.yaml"
+	k8sExternalSecretFile = "external-secret.yaml"
+	k8sJobFile            = "job.yaml"
+	k8sStatefulSetFile    = "statefulset.yaml"
+	k8sDaemonSetFile      = "daemonset.yaml"
+	k8sReplicaSetFile     = "replicaset.yaml"
 )
 
 const (
-	kusManifestKindNamespace  = "namespace"
-	K8sManifestKindDeployment = "deployment"
-	k8sManifestKindService    = "service"
-	k8sManifestKindIngress    = "ingress"
-	K8sManifestKindCronJob    = "cronjob"
-	k8sManifestKindPvc        = "pvc"
-	k8sManifestKindConfigMap  = "configmap"
+	kusManifestKindNamespace   = "namespace"
+	K8sManifestKindDeployment  = "deployment"
+	k8sManifestKindService     = "service"
+	k8sManifestKindIngress     = "ingress"
+	K8sManifestKindCronJob     = "cronjob"
+	k8sManifestKindPvc         = "pvc"
+	k8sManifestKindConfigMap   = "configmap"
+	K8sManifestKindStatefulSet = "statefulset"
+	K8sManifestKindJob         = "job"
+	K8sManifestKindDaemonSet   = "daemonset"
+	k8sManifestKindSecret      = "secret"
 )
 
 var k8sManifestKindsForCmd = []string{
-	"deployment", "cronjob",
+	"deployment", "cronjob", "statefulset", "job", "daemonset",
 }
 
 func SelectK8sManifestKind() (string, error) {
@@ -158,12 +164,16 @@ spec:
       labels:
         app: {{ .AppName }}
         tier: {{ .Tier }}
+      {{- template "podHealthAnnotations" . }}
     spec:
+      {{- template "podHealthSpec" . }}
       containers:
       - name: {{ .ContainerName }}
         image: {{ .Image }}:{{ .Tag }}
         ports:
-        - containerPort: {{ .Port }}
+        - name: http
+          containerPort: {{ .Port }}
+        {{- template "containerHealth" . }}
         {{- if .Resources }}
         resources:
           requests:
@@ -173,19 +183,95 @@ spec:
             memory: "{{ .Resources.Limits.Memory }}"
             cpu: "{{ .Resources.Limits.CPU }}"
         {{- end }}
-
         envFrom:
         - configMapRef:
             name: {{ .AppName }}-configmap
+        - secretRef:
+            name: {{ .AppName }}-secret
+            optional: true
+        volumeMounts:
+        - name: tmp
+          mountPath: /tmp
       volumes:
-            - name: user-api-volume
-              emptyDir:
-                medium: "Memory"
-            #- name: user-api-pvc
-            #  persistentVolumeClaim:
-            #    claimName: user-api-pvc
+      - name: tmp
+        emptyDir: {}
+      #- name: {{ .AppName }}-pvc
+      #  persistentVolumeClaim:
+      #    claimName: {{ .AppName }}-pvc
+` + k8sHealthTemplates
+
+// k8sHealthTemplates are appended to the workload templates. The health port is exposed next to
+// the app's port, probed by kubelet and scraped by Prometheus. On shutdown, preStop keeps the pod
+// serving until it is removed from the endpoints, then the app marks itself not ready and stops.
+const k8sHealthTemplates = `
+{{- define "podHealthAnnotations" }}{{ if .Health }}
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "{{ .Health.Port }}"
+        prometheus.io/path: "{{ .Health.MetricsPath }}"
+{{- end }}{{ end }}
+{{- define "podHealthSpec" }}
+      securityContext:
+        seccompProfile:
+          type: RuntimeDefault
+{{- if .Health }}
+      terminationGracePeriodSeconds: {{ .Health.TerminationGracePeriodSeconds }}
+{{- end }}{{ end }}
+{{- define "containerHealth" }}{{ if .Health }}
+        - name: health
+          containerPort: {{ .Health.Port }}
+        startupProbe:
+          httpGet:
+            path: {{ .Health.LivenessPath }}
+            port: health
+          periodSeconds: 2
+          failureThreshold: 30
+        livenessProbe:
+          httpGet:
+            path: {{ .Health.LivenessPath }}
+            port: health
+          periodSeconds: 10
+          failureThreshold: 3
+        readinessProbe:
+          httpGet:
+            path: {{ .Health.ReadinessPath }}
+            port: health
+          periodSeconds: 5
+          failureThreshold: 2
+        lifecycle:
+          preStop:
+            exec:
+              command: ["sleep", "{{ .Health.PreStopSeconds }}"]
+{{- end }}
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: ["ALL"]
+{{- end }}
 `
 
+// K8sHealth is the health endpoint served by the health module of generated cmds.
+type K8sHealth struct {
+	Port                          int
+	LivenessPath                  string
+	ReadinessPath                 string
+	MetricsPath                   string
+	PreStopSeconds                int
+	TerminationGracePeriodSeconds int
+}
+
+func newK8sHealth() *K8sHealth {
+	return &K8sHealth{
+		Port:          packages.HealthPort,
+		LivenessPath:  packages.HealthLivenessPath,
+		ReadinessPath: packages.HealthReadinessPath,
+		MetricsPath:   packages.HealthMetricsPath,
+		// preStop and the fx stop timeout (15s) of the generated main must fit in the grace period.
+		PreStopSeconds:                5,
+		TerminationGracePeriodSeconds: 30,
+	}
+}
+
 type K8sResourceRequirements struct {
 	Memory string
 	CPU    string
@@ -208,6 +294,7 @@ type K8sDeploymentData struct {
 	Tag           string
 	Port          int
 	Resources     *K8sResources
+	Health        *K8sHealth
 }
 
 func SelectK8sDeploymentTier() (string, error) {
@@ -259,7 +346,8 @@ func GenerateK8sDeploymentFile(tier string, namespace string, cmdDepth ...string
 		Image:         GlobalConfig.RemoteRegistry + "/" + GlobalConfig.Namespace + "/" + appName,
 		Tag:           "latest",
 		Port:          8080,
-		Replicas:      3,
+		Replicas:      getK8sTierPolicy(tier).Replicas,
+		Health:        newK8sHealth(),
 		Resources: &K8sResources{
 			Requests: K8sResourceRequirements{
 				Memory: "256Mi",
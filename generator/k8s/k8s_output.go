@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	K8sOutputTable = "table"
+	K8sOutputJSON  = "json"
+	K8sOutputYAML  = "yaml"
+)
+
+var K8sOutputs = []string{K8sOutputTable, K8sOutputJSON, K8sOutputYAML}
+
+func CheckK8sOutput(output string) error {
+	if !slices.Contains(K8sOutputs, output) {
+		return fmt.Errorf("unknown output %s, expected one of %s", output, strings.Join(K8sOutputs, ", "))
+	}
+
+	return nil
+}
+
+// printK8sStructured prints the value as JSON or YAML, with the field names of its JSON tags.
+func printK8sStructured(output string, value any) error {
+	switch output {
+	case K8sOutputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case K8sOutputYAML:
+		out, err := sigsyaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		return CheckK8sOutput(output)
+	}
+}
@@ -0,0 +1,400 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/fatih/color"
+	"golang.org/x/term"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+
+	"github.com/gosuda/ako/generator/packages"
+)
+
+const k8sLogsMaxLineSize = 1024 * 1024
+
+// k8sLogColors tell the pods of an app apart when their logs are interleaved.
+var k8sLogColors = []*color.Color{
+	color.New(color.FgCyan),
+	color.New(color.FgGreen),
+	color.New(color.FgYellow),
+	color.New(color.FgMagenta),
+	color.New(color.FgBlue),
+	color.New(color.FgHiCyan),
+	color.New(color.FgHiGreen),
+	color.New(color.FgHiYellow),
+	color.New(color.FgHiMagenta),
+	color.New(color.FgHiBlue),
+}
+
+// GetK8sAppName returns the app name of a cmd path such as api/auth, which is auth-api, or the
+// target itself when it already is an app name.
+func GetK8sAppName(target string) string {
+	target = strings.TrimPrefix(strings.Trim(target, "/"), packages.RootPackageCmd+"/")
+	return MakeCmdDepthToName(strings.Split(target, "/")...)
+}
+
+// SelectK8sAppName returns the app name of the target, or of the cmd selected when it is empty.
+func SelectK8sAppName(target string) (string, error) {
+	if target == "" {
+		var err error
+		target, err = packages.SelectCmdName()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return GetK8sAppName(target), nil
+}
+
+type K8sPod struct {
+	Name       string
+	Phase      string
+	Containers []string
+	Ports      []int
+}
+
+// ListK8sAppPods lists the pods of the app by its app label, leaving out the terminating ones.
+func ListK8sAppPods(ctx context.Context, appName string) ([]K8sPod, error) {
+	client, err := getK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := client.clientset.CoreV1().Pods(GlobalConfig.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + appName})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]K8sPod, 0, len(list.Items))
+	for _, item := range list.Items {
+		if item.DeletionTimestamp != nil {
+			continue
+		}
+
+		pod := K8sPod{Name: item.Name, Phase: string(item.Status.Phase)}
+		for _, container := range item.Spec.Containers {
+			pod.Containers = append(pod.Containers, container.Name)
+			for _, port := range container.Ports {
+				pod.Ports = append(pod.Ports, int(port.ContainerPort))
+			}
+		}
+		pods = append(pods, pod)
+	}
+
+	return pods, nil
+}
+
+// SelectK8sAppPod returns the running pod of the app, asking which one when it has several.
+func SelectK8sAppPod(ctx context.Context, appName string) (*K8sPod, error) {
+	pods, err := ListK8sAppPods(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	running := make([]K8sPod, 0, len(pods))
+	for _, pod := range pods {
+		if pod.Phase == "Running" {
+			running = append(running, pod)
+		}
+	}
+
+	switch len(running) {
+	case 0:
+		return nil, fmt.Errorf("no running pods of %s in %s", appName, GlobalConfig.Namespace)
+	case 1:
+		return &running[0], nil
+	}
+
+	options := make([]string, 0, len(running))
+	for _, pod := range running {
+		options = append(options, pod.Name)
+	}
+
+	var selected string
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select the pod:",
+		Options: options,
+	}, &selected, survey.WithValidator(survey.Required)); err != nil {
+		return nil, err
+	}
+
+	for i := range running {
+		if running[i].Name == selected {
+			return &running[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("pod %s not found", selected)
+}
+
+type K8sLogsOption struct {
+	Follow bool
+	// Tail is the number of recent lines to show, or -1 for all of them.
+	Tail      int
+	Since     string
+	Container string
+	Previous  bool
+}
+
+// StreamK8sAppLogs prints the logs of every pod of the app, each line prefixed with its pod in the
+// pod's color, and its container when the pod has several. Following streams all of them at once
+// until the context is done.
+func StreamK8sAppLogs(ctx context.Context, appName string, option K8sLogsOption) error {
+	pods, err := ListK8sAppPods(ctx, appName)
+	if err != nil {
+		return err
+	}
+
+	if len(pods) == 0 {
+		return fmt.Errorf("no pods of %s in %s", appName, GlobalConfig.Namespace)
+	}
+
+	logOptions, err := option.podLogOptions()
+	if err != nil {
+		return err
+	}
+
+	streams := make([]k8sLogStream, 0, len(pods))
+	for i, pod := range pods {
+		containers := pod.Containers
+		if option.Container != "" {
+			containers = []string{option.Container}
+		}
+
+		for _, container := range containers {
+			prefix := pod.Name
+			if len(containers) > 1 {
+				prefix += "/" + container
+			}
+			options := logOptions.DeepCopy()
+			options.Container = container
+			streams = append(streams, k8sLogStream{
+				pod:     pod.Name,
+				prefix:  k8sLogColors[i%len(k8sLogColors)].Sprintf("[%s]", prefix),
+				options: options,
+			})
+		}
+	}
+
+	var mu sync.Mutex
+	if !option.Follow {
+		for _, stream := range streams {
+			if err := stream.print(ctx, &mu); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(streams))
+	for i, stream := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = stream.print(ctx, &mu)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o K8sLogsOption) podLogOptions() (*corev1.PodLogOptions, error) {
+	options := &corev1.PodLogOptions{Follow: o.Follow, Previous: o.Previous}
+	if o.Tail >= 0 {
+		tail := int64(o.Tail)
+		options.TailLines = &tail
+	}
+
+	if o.Since != "" {
+		since, err := time.ParseDuration(o.Since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since %q: %w", o.Since, err)
+		}
+		seconds := int64(since.Round(time.Second).Seconds())
+		options.SinceSeconds = &seconds
+	}
+
+	return options, nil
+}
+
+// k8sLogStream is the logs of a container of a pod.
+type k8sLogStream struct {
+	pod     string
+	prefix  string
+	options *corev1.PodLogOptions
+}
+
+func (s k8sLogStream) print(ctx context.Context, mu *sync.Mutex) error {
+	client, err := getK8sClient()
+	if err != nil {
+		return err
+	}
+
+	logs, err := client.clientset.CoreV1().Pods(GlobalConfig.Namespace).GetLogs(s.pod, s.options).Stream(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("logs of %s: %w", s.pod, err)
+	}
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 0, 64*1024), k8sLogsMaxLineSize)
+	for scanner.Scan() {
+		mu.Lock()
+		fmt.Println(s.prefix, scanner.Text())
+		mu.Unlock()
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("logs of %s: %w", s.pod, err)
+	}
+
+	return nil
+}
+
+// ExecK8sPod runs the command in the pod, in its first container unless another is given,
+// attaching a terminal when ako runs in one.
+func ExecK8sPod(ctx context.Context, pod *K8sPod, container string, command ...string) error {
+	client, err := getK8sClient()
+	if err != nil {
+		return err
+	}
+
+	if container == "" && len(pod.Containers) > 0 {
+		container = pod.Containers[0]
+	}
+
+	stdin := int(os.Stdin.Fd())
+	tty := term.IsTerminal(stdin)
+	request := client.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(GlobalConfig.Namespace).
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    !tty,
+			TTY:       tty,
+		}, scheme.ParameterCodec)
+
+	// Like kubectl, exec over websockets and fall back to SPDY on servers without them.
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(client.config, "POST", request.URL())
+	if err != nil {
+		return err
+	}
+
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(client.config, "GET", request.URL().String())
+	if err != nil {
+		return err
+	}
+
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	options := remotecommand.StreamOptions{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr, Tty: tty}
+	if tty {
+		state, err := term.MakeRaw(stdin)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(stdin, state)
+
+		if width, height, err := term.GetSize(stdin); err == nil {
+			options.TerminalSizeQueue = &k8sTerminalSize{size: &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}}
+		}
+	}
+
+	return executor.StreamWithContext(ctx, options)
+}
+
+// k8sTerminalSize sizes the terminal of an exec once, to the size of ako's terminal.
+type k8sTerminalSize struct {
+	size *remotecommand.TerminalSize
+}
+
+func (s *k8sTerminalSize) Next() *remotecommand.TerminalSize {
+	size := s.size
+	s.size = nil
+	return size
+}
+
+// PortForwardK8sPod forwards the ports, given as local:remote or port, to the pod until
+// interrupted. Without ports, every container port is forwarded to the same local port.
+func PortForwardK8sPod(ctx context.Context, pod *K8sPod, ports ...string) error {
+	if len(ports) == 0 {
+		for _, port := range pod.Ports {
+			ports = append(ports, strconv.Itoa(port))
+		}
+	}
+
+	if len(ports) == 0 {
+		return fmt.Errorf("%s exposes no container ports, give the ports to forward", pod.Name)
+	}
+
+	client, err := getK8sClient()
+	if err != nil {
+		return err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(client.config)
+	if err != nil {
+		return err
+	}
+
+	url := client.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(GlobalConfig.Namespace).
+		Name(pod.Name).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	stop := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(stop)
+	}()
+
+	forwarder, err := portforward.New(dialer, ports, stop, nil, os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	return forwarder.ForwardPorts()
+}
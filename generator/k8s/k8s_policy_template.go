@@ -0,0 +1,392 @@
+package k8s
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+const (
+	K8sPolicyHPA           = "HorizontalPodAutoscaler"
+	K8sPolicyPDB           = "PodDisruptionBudget"
+	K8sPolicyNetworkPolicy = "NetworkPolicy"
+)
+
+const (
+	k8sHpaFile           = "hpa.yaml"
+	k8sPdbFile           = "pdb.yaml"
+	k8sNetworkPolicyFile = "networkpolicy.yaml"
+)
+
+const (
+	k8sHPAMetricCPU    = "cpu"
+	k8sHPAMetricCustom = "custom"
+)
+
+// Who may reach the app's http port. The health port stays open to every namespace, so
+// Prometheus can scrape it.
+const (
+	k8sIngressAll       = "all"
+	k8sIngressNamespace = "namespace"
+	k8sIngressTiers     = "tiers"
+	k8sIngressNone      = "none"
+)
+
+// k8sTierPolicy holds the scaling and network defaults implied by a tier.
+type k8sTierPolicy struct {
+	Replicas       int
+	MinReplicas    int
+	MaxReplicas    int
+	CPUUtilization int
+	Ingress        string
+	FromTiers      []string
+	Description    string
+}
+
+var k8sTierPolicies = map[string]k8sTierPolicy{
+	"service": {
+		Replicas: 2, MinReplicas: 2, MaxReplicas: 10, CPUUtilization: 70,
+		Ingress: k8sIngressTiers, FromTiers: []string{"aggregator", "orchestrator"},
+		Description: "Reachable only from aggregators and orchestrators in the namespace",
+	},
+	"aggregator": {
+		Replicas: 3, MinReplicas: 3, MaxReplicas: 20, CPUUtilization: 60,
+		Ingress:     k8sIngressAll,
+		Description: "Entry point of user requests, reachable from the ingress controller",
+	},
+	"orchestrator": {
+		Replicas: 2, MinReplicas: 2, MaxReplicas: 5, CPUUtilization: 70,
+		Ingress: k8sIngressTiers, FromTiers: []string{"aggregator"},
+		Description: "Reachable only from aggregators in the namespace",
+	},
+	"worker": {
+		Replicas: 1, MinReplicas: 1, MaxReplicas: 20, CPUUtilization: 80,
+		Ingress:     k8sIngressNone,
+		Description: "Receives no traffic, only consumes tasks",
+	},
+	"middleware": {
+		Replicas: 2, MinReplicas: 2, MaxReplicas: 5, CPUUtilization: 70,
+		Ingress:     k8sIngressNamespace,
+		Description: "Reachable from every pod in the namespace",
+	},
+}
+
+// getK8sTierPolicy returns the defaults of the tier. Custom tiers are treated like middleware.
+func getK8sTierPolicy(tier string) k8sTierPolicy {
+	if policy, ok := k8sTierPolicies[tier]; ok {
+		return policy
+	}
+
+	return k8sTierPolicies["middleware"]
+}
+
+// SelectK8sPolicies asks which of the policies that apply to the workload kind to generate.
+func SelectK8sPolicies(kind string) ([]string, error) {
+	options := make([]string, 0, 3)
+	if k8sWorkloads[kind].replicas {
+		options = append(options, K8sPolicyHPA)
+	}
+	if kind != K8sManifestKindJob {
+		options = append(options, K8sPolicyPDB)
+	}
+	options = append(options, K8sPolicyNetworkPolicy)
+
+	var selected []string
+	if err := survey.AskOne(&survey.MultiSelect{
+		Message: "Select the policies to generate:",
+		Options: options,
+		Default: []string{K8sPolicyNetworkPolicy},
+		Help:    "Use space to select, enter to confirm",
+	}, &selected); err != nil {
+		return nil, err
+	}
+
+	return selected, nil
+}
+
+// InputK8sPolicies asks which policies to generate for the workload, and the metric to scale on
+// when a HorizontalPodAutoscaler is selected.
+func InputK8sPolicies(kind string, tier string) ([]string, *K8sHPAMetric, error) {
+	policies, err := SelectK8sPolicies(kind)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !slices.Contains(policies, K8sPolicyHPA) {
+		return policies, nil, nil
+	}
+
+	metric, err := InputK8sHPAMetric(tier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return policies, metric, nil
+}
+
+type K8sHPAMetric struct {
+	Type           string
+	CPUUtilization int
+	Name           string
+	AverageValue   string
+}
+
+func InputK8sHPAMetric(tier string) (*K8sHPAMetric, error) {
+	metric := &K8sHPAMetric{}
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select the metric to scale on:",
+		Options: []string{k8sHPAMetricCPU, k8sHPAMetricCustom},
+		Description: func(value string, index int) string {
+			if value == k8sHPAMetricCustom {
+				return "per pod metric served by a metrics adapter, e.g. queue depth"
+			}
+			return "average CPU utilization of the requests"
+		},
+	}, &metric.Type); err != nil {
+		return nil, err
+	}
+
+	if metric.Type == k8sHPAMetricCPU {
+		utilization := strconv.Itoa(getK8sTierPolicy(tier).CPUUtilization)
+		if err := survey.AskOne(&survey.Input{
+			Message: "Enter the target CPU utilization (%):",
+			Default: utilization,
+		}, &utilization, survey.WithValidator(func(ans interface{}) error {
+			if v, err := strconv.Atoi(ans.(string)); err != nil || v < 1 || v > 100 {
+				return fmt.Errorf("utilization must be between 1 and 100")
+			}
+			return nil
+		})); err != nil {
+			return nil, err
+		}
+
+		metric.CPUUtilization, _ = strconv.Atoi(utilization)
+		return metric, nil
+	}
+
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the custom metric name:",
+	}, &metric.Name, survey.WithValidator(survey.Required)); err != nil {
+		return nil, err
+	}
+
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the target average value per pod:",
+		Default: "10",
+	}, &metric.AverageValue, survey.WithValidator(survey.Required)); err != nil {
+		return nil, err
+	}
+
+	return metric, nil
+}
+
+const k8sHpaTemplate = `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{ .AppName }}-hpa
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+    tier: {{ .Tier }}
+spec:
+  scaleTargetRef:
+    apiVersion: {{ .TargetAPIVersion }}
+    kind: {{ .TargetKind }}
+    name: {{ .TargetName }}
+  minReplicas: {{ .MinReplicas }}
+  maxReplicas: {{ .MaxReplicas }}
+  metrics:
+  {{- if eq .Metric.Type "cpu" }}
+  - type: Resource
+    resource:
+      name: cpu
+      target:
+        type: Utilization
+        averageUtilization: {{ .Metric.CPUUtilization }}
+  {{- else }}
+  - type: Pods
+    pods:
+      metric:
+        name: {{ .Metric.Name }}
+      target:
+        type: AverageValue
+        averageValue: {{ quote .Metric.AverageValue }}
+  {{- end }}
+`
+
+type K8sHPAData struct {
+	AppName          string
+	Namespace        string
+	Tier             string
+	TargetAPIVersion string
+	TargetKind       string
+	TargetName       string
+	MinReplicas      int
+	MaxReplicas      int
+	Metric           *K8sHPAMetric
+}
+
+// getK8sLocalHPAReplicas returns the replica bounds of the tier for the local cluster, which is
+// kept small.
+func getK8sLocalHPAReplicas(tier string) (int, int) {
+	return 1, min(getK8sTierPolicy(tier).MaxReplicas, 3)
+}
+
+func newK8sHPAData(kind string, tier string, metric *K8sHPAMetric, namespace string, appName string) (K8sHPAData, error) {
+	workload, ok := k8sWorkloads[kind]
+	if !ok || !workload.replicas {
+		return K8sHPAData{}, fmt.Errorf("%s cannot be scaled by a HorizontalPodAutoscaler", kind)
+	}
+
+	policy := getK8sTierPolicy(tier)
+	return K8sHPAData{
+		AppName:          appName,
+		Namespace:        namespace,
+		Tier:             tier,
+		TargetAPIVersion: workload.apiVersion,
+		TargetKind:       workload.kind,
+		TargetName:       appName + workload.suffix,
+		MinReplicas:      policy.MinReplicas,
+		MaxReplicas:      policy.MaxReplicas,
+		Metric:           metric,
+	}, nil
+}
+
+func GenerateK8sHPAFile(kind string, tier string, metric *K8sHPAMetric, namespace string, cmdDepth ...string) error {
+	data, err := newK8sHPAData(kind, tier, metric, namespace, MakeCmdDepthToName(cmdDepth...))
+	if err != nil {
+		return err
+	}
+
+	if err := writeK8sManifestFile(k8sEnvRemote, k8sHpaFile, k8sHpaTemplate, data, cmdDepth...); err != nil {
+		return err
+	}
+
+	data.MinReplicas, data.MaxReplicas = getK8sLocalHPAReplicas(tier)
+	if err := writeK8sManifestFile(k8sEnvLocal, k8sHpaFile, k8sHpaTemplate, data, cmdDepth...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const k8sPdbTemplate = `apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .AppName }}-pdb
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+spec:
+  maxUnavailable: {{ .MaxUnavailable }}
+  selector:
+    matchLabels:
+      app: {{ .AppName }}
+`
+
+type K8sPDBData struct {
+	AppName        string
+	Namespace      string
+	MaxUnavailable int
+}
+
+func newK8sPDBData(namespace string, appName string) K8sPDBData {
+	return K8sPDBData{
+		AppName:        appName,
+		Namespace:      namespace,
+		MaxUnavailable: 1,
+	}
+}
+
+// GenerateK8sPDBFile limits voluntary disruptions, such as node drains, to one pod at a time. It
+// uses maxUnavailable rather than minAvailable, which would block drains of single replica apps.
+func GenerateK8sPDBFile(namespace string, cmdDepth ...string) error {
+	data := newK8sPDBData(namespace, MakeCmdDepthToName(cmdDepth...))
+
+	for _, env := range []string{k8sEnvRemote, k8sEnvLocal} {
+		if err := writeK8sManifestFile(env, k8sPdbFile, k8sPdbTemplate, data, cmdDepth...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const k8sNetworkPolicyTemplate = `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: {{ .AppName }}-networkpolicy
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+    tier: {{ .Tier }}
+  annotations:
+    description: "{{ .Description }}"
+spec:
+  podSelector:
+    matchLabels:
+      app: {{ .AppName }}
+  policyTypes:
+  - Ingress
+  ingress:
+  {{- if eq .Ingress "all" }}
+  - ports:
+    - port: http
+  {{- else if eq .Ingress "namespace" }}
+  - from:
+    - podSelector: {}
+    ports:
+    - port: http
+  {{- else if eq .Ingress "tiers" }}
+  - from:
+    - podSelector:
+        matchExpressions:
+        - key: tier
+          operator: In
+          values:
+          {{- range .FromTiers }}
+          - {{ . }}
+          {{- end }}
+    ports:
+    - port: http
+  {{- end }}
+  - from:
+    - namespaceSelector: {}
+    ports:
+    - port: health
+`
+
+type K8sNetworkPolicyData struct {
+	AppName     string
+	Namespace   string
+	Tier        string
+	Ingress     string
+	FromTiers   []string
+	Description string
+}
+
+func newK8sNetworkPolicyData(tier string, namespace string, appName string) K8sNetworkPolicyData {
+	policy := getK8sTierPolicy(tier)
+	return K8sNetworkPolicyData{
+		AppName:     appName,
+		Namespace:   namespace,
+		Tier:        tier,
+		Ingress:     policy.Ingress,
+		FromTiers:   policy.FromTiers,
+		Description: policy.Description,
+	}
+}
+
+func GenerateK8sNetworkPolicyFile(tier string, namespace string, cmdDepth ...string) error {
+	data := newK8sNetworkPolicyData(tier, namespace, MakeCmdDepthToName(cmdDepth...))
+
+	for _, env := range []string{k8sEnvRemote, k8sEnvLocal} {
+		if err := writeK8sManifestFile(env, k8sNetworkPolicyFile, k8sNetworkPolicyTemplate, data, cmdDepth...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,418 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+const (
+	k8sRolloutTimeout  = 3 * time.Minute
+	k8sRolloutInterval = time.Second
+)
+
+const (
+	k8sChangeCauseAnnotation = "kubernetes.io/change-cause"
+	k8sRevisionAnnotation    = "deployment.kubernetes.io/revision"
+)
+
+func getK8sDeploymentName(appName string) string {
+	return appName + k8sWorkloads[K8sManifestKindDeployment].suffix
+}
+
+func getK8sDeployment(ctx context.Context, appName string) (*appsv1.Deployment, error) {
+	client, err := getK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.clientset.AppsV1().Deployments(GlobalConfig.Namespace).Get(ctx, getK8sDeploymentName(appName), metav1.GetOptions{})
+}
+
+// updateK8sDeployment changes the app's Deployment with mutate, retrying on the latest version of it
+// when someone else changed it in between.
+func updateK8sDeployment(ctx context.Context, appName string, mutate func(deployment *appsv1.Deployment) error) error {
+	client, err := getK8sClient()
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := getK8sDeployment(ctx, appName)
+		if err != nil {
+			return err
+		}
+
+		if err := mutate(deployment); err != nil {
+			return err
+		}
+
+		_, err = client.clientset.AppsV1().Deployments(GlobalConfig.Namespace).Update(ctx, deployment, metav1.UpdateOptions{FieldManager: k8sFieldManager})
+		return err
+	})
+}
+
+func K8sDeploymentExists(ctx context.Context, appName string) (bool, error) {
+	if _, err := getK8sDeployment(ctx, appName); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetK8sDeploymentImage points every container of the app's Deployment at the image.
+func SetK8sDeploymentImage(ctx context.Context, appName string, image string) error {
+	return updateK8sDeployment(ctx, appName, func(deployment *appsv1.Deployment) error {
+		for i := range deployment.Spec.Template.Spec.Containers {
+			deployment.Spec.Template.Spec.Containers[i].Image = image
+		}
+		return nil
+	})
+}
+
+// WaitK8sDeploymentRollout waits until every replica of the app's Deployment runs its latest
+// template, logging the progress of the rollout the way kubectl rollout status does.
+func WaitK8sDeploymentRollout(ctx context.Context, appName string) error {
+	name := getK8sDeploymentName(appName)
+	last := ""
+	err := wait.PollUntilContextTimeout(ctx, k8sRolloutInterval, k8sRolloutTimeout, true, func(ctx context.Context) (bool, error) {
+		deployment, err := getK8sDeployment(ctx, appName)
+		if err != nil {
+			return false, err
+		}
+
+		message, done, err := getK8sRolloutStatus(deployment)
+		if err != nil {
+			return false, err
+		}
+
+		if message != last {
+			log.Print(message)
+			last = message
+		}
+
+		return done, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("timed out waiting for the rollout of deployment %q after %s", name, k8sRolloutTimeout)
+	}
+
+	return err
+}
+
+func getK8sRolloutStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return "Waiting for deployment spec update to be observed...", false, nil
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("deployment %q exceeded its progress deadline", deployment.Name)
+		}
+	}
+
+	status := deployment.Status
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	switch {
+	case status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...", deployment.Name, status.UpdatedReplicas, replicas), false, nil
+	case status.Replicas > status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...", deployment.Name, status.Replicas-status.UpdatedReplicas), false, nil
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...", deployment.Name, status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+
+	return fmt.Sprintf("deployment %q successfully rolled out", deployment.Name), true, nil
+}
+
+// AnnotateK8sDeploymentChangeCause records why the next rollout happens. It must precede the
+// change that rolls out, since the new ReplicaSet copies the annotation when it is created.
+func AnnotateK8sDeploymentChangeCause(ctx context.Context, appName string, changeCause string) error {
+	client, err := getK8sClient()
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{k8sChangeCauseAnnotation: changeCause},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.clientset.AppsV1().Deployments(GlobalConfig.Namespace).Patch(ctx, getK8sDeploymentName(appName), types.MergePatchType, patch, metav1.PatchOptions{FieldManager: k8sFieldManager})
+	return err
+}
+
+// MakeK8sChangeCause describes a build of the version at the git HEAD described by head.
+func MakeK8sChangeCause(version string, head string) string {
+	if head == "" {
+		return version
+	}
+
+	return version + " from " + head
+}
+
+// SetK8sDeploymentBuild points the local Deployment manifest of the cmd at the image of the built
+// version, and records the build as its change-cause, so applying the manifest adds the build to
+// the rollout history. It reports false when the cmd has no local Deployment manifest.
+func SetK8sDeploymentBuild(version string, changeCause string, cmdDepth ...string) (bool, error) {
+	path := makeK8sManifestFile(k8sEnvLocal, k8sDeploymentFile, cmdDepth...)
+	documents, err := loadYamlDocuments(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	repository := getK8sImage(GlobalConfig.LocalRegistry, MakeCmdDepthToName(cmdDepth...))
+	updated := false
+	for _, document := range documents {
+		root := yamlRoot(document)
+		if yamlString(root, "kind") != "Deployment" {
+			continue
+		}
+
+		yamlEnsure(root, yaml.ScalarNode, "metadata", "labels", "version").Value = version
+		yamlEnsure(root, yaml.ScalarNode, "metadata", "annotations", k8sChangeCauseAnnotation).Value = changeCause
+
+		containers := yamlLookup(root, "spec", "template", "spec", "containers")
+		if containers == nil {
+			continue
+		}
+
+		for _, container := range containers.Content {
+			image := yamlLookup(container, "image")
+			if image == nil || (image.Value != repository && !strings.HasPrefix(image.Value, repository+":") && !strings.HasPrefix(image.Value, repository+"@")) {
+				continue
+			}
+			image.Value = repository + ":" + version
+		}
+		updated = true
+	}
+
+	if !updated {
+		return false, nil
+	}
+
+	if err := writeYamlDocuments(path, documents); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+type K8sRevision struct {
+	Revision    int       `json:"revision"`
+	Images      []string  `json:"images"`
+	ChangeCause string    `json:"changeCause"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Current     bool      `json:"current"`
+}
+
+// listK8sDeploymentReplicaSets lists the ReplicaSets of the app's Deployment, which keep the pod
+// template, change-cause and creation time of each of its revisions.
+func listK8sDeploymentReplicaSets(ctx context.Context, deployment *appsv1.Deployment) ([]appsv1.ReplicaSet, error) {
+	client, err := getK8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := client.clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets := make([]appsv1.ReplicaSet, 0, len(list.Items))
+	for _, replicaSet := range list.Items {
+		if metav1.IsControlledBy(&replicaSet, deployment) {
+			replicaSets = append(replicaSets, replicaSet)
+		}
+	}
+
+	return replicaSets, nil
+}
+
+// ListK8sDeploymentRevisions lists the revisions of the app's Deployment, oldest first.
+func ListK8sDeploymentRevisions(ctx context.Context, appName string) ([]K8sRevision, error) {
+	deployment, err := getK8sDeployment(ctx, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets, err := listK8sDeploymentReplicaSets(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	current := deployment.Annotations[k8sRevisionAnnotation]
+	revisions := make([]K8sRevision, 0, len(replicaSets))
+	for _, replicaSet := range replicaSets {
+		number, err := strconv.Atoi(replicaSet.Annotations[k8sRevisionAnnotation])
+		if err != nil {
+			continue
+		}
+
+		revision := K8sRevision{
+			Revision:    number,
+			ChangeCause: replicaSet.Annotations[k8sChangeCauseAnnotation],
+			CreatedAt:   replicaSet.CreationTimestamp.Time,
+			Current:     replicaSet.Annotations[k8sRevisionAnnotation] == current,
+		}
+		for _, container := range replicaSet.Spec.Template.Spec.Containers {
+			revision.Images = append(revision.Images, container.Image)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	slices.SortFunc(revisions, func(a, b K8sRevision) int {
+		return a.Revision - b.Revision
+	})
+
+	return revisions, nil
+}
+
+// k8sImageVersion returns the tag of the image, or its shortened digest when pinned by one.
+func k8sImageVersion(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		digest := image[i+1:]
+		if _, hex, ok := strings.Cut(digest, ":"); ok && len(hex) > 12 {
+			return digest[:len(digest)-len(hex)+12]
+		}
+		return digest
+	}
+
+	return k8sImageTag(image)
+}
+
+func (r K8sRevision) imageVersions() string {
+	versions := make([]string, 0, len(r.Images))
+	for _, image := range r.Images {
+		versions = append(versions, k8sImageVersion(image))
+	}
+
+	return strings.Join(versions, ", ")
+}
+
+func PrintK8sRevisions(revisions []K8sRevision, output string) error {
+	if output != K8sOutputTable {
+		return printK8sStructured(output, revisions)
+	}
+
+	tbl := table.NewTableBuilder("REVISION", "IMAGE", "CHANGE-CAUSE", "CREATED AT", "CURRENT")
+	for _, revision := range revisions {
+		current := ""
+		if revision.Current {
+			current = "*"
+		}
+		tbl.AppendRow(strconv.Itoa(revision.Revision), revision.imageVersions(), revision.ChangeCause, revision.CreatedAt.Local().Format(time.DateTime), current)
+	}
+	tbl.Print()
+
+	return nil
+}
+
+// SelectK8sRevision asks which of the previous revisions to roll back to, newest first.
+func SelectK8sRevision(revisions []K8sRevision) (int, error) {
+	options := make([]string, 0, len(revisions))
+	numbers := make([]int, 0, len(revisions))
+	for _, revision := range slices.Backward(revisions) {
+		if revision.Current {
+			continue
+		}
+		options = append(options, fmt.Sprintf("%d: %s", revision.Revision, revision.imageVersions()))
+		numbers = append(numbers, revision.Revision)
+	}
+
+	if len(options) == 0 {
+		return 0, fmt.Errorf("no previous revisions to roll back to")
+	}
+
+	var selected int
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select the revision to roll back to:",
+		Options: options,
+		Description: func(value string, index int) string {
+			for _, revision := range revisions {
+				if revision.Revision == numbers[index] {
+					return revision.ChangeCause + " (" + revision.CreatedAt.Local().Format(time.DateTime) + ")"
+				}
+			}
+			return ""
+		},
+	}, &selected); err != nil {
+		return 0, err
+	}
+
+	return numbers[selected], nil
+}
+
+// UndoK8sDeployment rolls the app's Deployment back to the pod template of the revision, the way
+// kubectl rollout undo does, bringing its change-cause along.
+func UndoK8sDeployment(ctx context.Context, appName string, revision int) error {
+	return updateK8sDeployment(ctx, appName, func(deployment *appsv1.Deployment) error {
+		if deployment.Spec.Paused {
+			return fmt.Errorf("deployment %q is paused, resume it before rolling back", deployment.Name)
+		}
+
+		replicaSets, err := listK8sDeploymentReplicaSets(ctx, deployment)
+		if err != nil {
+			return err
+		}
+
+		index := slices.IndexFunc(replicaSets, func(replicaSet appsv1.ReplicaSet) bool {
+			return replicaSet.Annotations[k8sRevisionAnnotation] == strconv.Itoa(revision)
+		})
+		if index < 0 {
+			return fmt.Errorf("revision %d of deployment %q not found", revision, deployment.Name)
+		}
+
+		template := replicaSets[index].Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		if equality.Semantic.DeepEqual(template, &deployment.Spec.Template) {
+			return fmt.Errorf("deployment %q already runs revision %d", deployment.Name, revision)
+		}
+		deployment.Spec.Template = *template
+
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		if changeCause, ok := replicaSets[index].Annotations[k8sChangeCauseAnnotation]; ok {
+			deployment.Annotations[k8sChangeCauseAnnotation] = changeCause
+		} else {
+			delete(deployment.Annotations, k8sChangeCauseAnnotation)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,95 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestK8sReplicaSet(name string, owner *appsv1.Deployment, revision string, changeCause string, image string) *appsv1.ReplicaSet {
+	labels := map[string]string{"app": "auth-api", appsv1.DefaultDeploymentUniqueLabelKey: name}
+	return &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       owner.Namespace,
+			Labels:          labels,
+			Annotations:     map[string]string{k8sRevisionAnnotation: revision, k8sChangeCauseAnnotation: changeCause},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(owner, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "auth-api", Image: image}}},
+			},
+		},
+	}
+}
+
+func TestUndoK8sDeployment(t *testing.T) {
+	GlobalConfig = K3dConfig{Cluster: "test", Namespace: "test"}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "auth-api-deployment",
+			Namespace:   "test",
+			UID:         types.UID("auth-api"),
+			Annotations: map[string]string{k8sRevisionAnnotation: "2", k8sChangeCauseAnnotation: "v2 from b"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "auth-api"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "auth-api"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "auth-api", Image: "registry/test/auth-api:v2"}}},
+			},
+		},
+	}
+	other := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "test", UID: types.UID("other")}}
+
+	k8sClientCached = &k8sClient{clientset: fake.NewClientset(
+		deployment,
+		newTestK8sReplicaSet("auth-api-1", deployment, "1", "v1 from a", "registry/test/auth-api:v1"),
+		newTestK8sReplicaSet("auth-api-2", deployment, "2", "v2 from b", "registry/test/auth-api:v2"),
+		newTestK8sReplicaSet("other-1", other, "1", "other", "registry/test/other:v1"),
+	)}
+	t.Cleanup(func() { k8sClientCached = nil })
+
+	ctx := context.Background()
+	revisions, err := ListK8sDeploymentRevisions(ctx, "auth-api")
+	if err != nil {
+		t.Fatalf("Failed to list revisions: %v", err)
+	}
+
+	if len(revisions) != 2 || revisions[0].Revision != 1 || revisions[1].Revision != 2 || !revisions[1].Current || revisions[0].ChangeCause != "v1 from a" {
+		t.Fatalf("Unexpected revisions: %+v", revisions)
+	}
+
+	if err := UndoK8sDeployment(ctx, "auth-api", 1); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+
+	undone, err := getK8sDeployment(ctx, "auth-api")
+	if err != nil {
+		t.Fatalf("Failed to get deployment: %v", err)
+	}
+
+	if image := undone.Spec.Template.Spec.Containers[0].Image; image != "registry/test/auth-api:v1" {
+		t.Errorf("Expected the image of revision 1, got %s", image)
+	}
+
+	if _, ok := undone.Spec.Template.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok {
+		t.Errorf("Expected the pod-template-hash label to be removed, got %v", undone.Spec.Template.Labels)
+	}
+
+	if changeCause := undone.Annotations[k8sChangeCauseAnnotation]; changeCause != "v1 from a" {
+		t.Errorf("Expected the change-cause of revision 1, got %s", changeCause)
+	}
+
+	if err := UndoK8sDeployment(ctx, "auth-api", 3); err == nil {
+		t.Errorf("Expected undoing to a missing revision to fail")
+	}
+}
@@ -0,0 +1,623 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gosuda/ako/util/template"
+)
+
+const (
+	K8sRouteOutputIngress      = "ingress"
+	K8sRouteOutputIngressRoute = "ingressroute"
+	K8sRouteOutputHTTPRoute    = "httproute"
+)
+
+var K8sRouteOutputs = []string{K8sRouteOutputIngress, K8sRouteOutputIngressRoute, K8sRouteOutputHTTPRoute}
+
+const (
+	k8sIngressRouteFile = "ingressroute.yaml"
+	k8sHTTPRouteFile    = "httproute.yaml"
+	k8sGatewayFile      = "gateway.yaml"
+
+	// k8sGatewayClassName is the GatewayClass of traefik, the ingress controller k3d comes with,
+	// once its Gateway API provider is enabled.
+	k8sGatewayClassName = "traefik"
+
+	// k8sIngressPlaceholderService is the backend written by GenerateK8sIngressFile, it is dropped
+	// once a real route is added.
+	k8sIngressPlaceholderService = "input-your-inner-service"
+)
+
+// K8sRouteService is a Service generated for a cmd, which routes can point at.
+type K8sRouteService struct {
+	AppName string
+	Name    string
+	Port    int
+	File    string
+}
+
+type K8sRoute struct {
+	Ingress string
+	Host    string
+	Path    string
+	Service K8sRouteService
+}
+
+// k8sIngressPath keeps the keys of a new ingress path in the usual order, maps are sorted.
+type k8sIngressPath struct {
+	Path     string         `yaml:"path"`
+	PathType string         `yaml:"pathType"`
+	Backend  map[string]any `yaml:"backend"`
+}
+
+func loadYamlDocuments(path string) ([]*yaml.Node, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	documents := make([]*yaml.Node, 0, 1)
+	decoder := yaml.NewDecoder(f)
+	for {
+		document := &yaml.Node{}
+		if err := decoder.Decode(document); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+func writeYamlDocuments(path string, documents []*yaml.Node) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := yaml.NewEncoder(f)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+// yamlNodeOf encodes a value into a node, so it can be inserted into a loaded document. Empty
+// collections are encoded in flow style, which would stick once items are added to them, so the
+// style is reset to block.
+func yamlNodeOf(value any) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+
+	var resetStyle func(*yaml.Node)
+	resetStyle = func(n *yaml.Node) {
+		n.Style &^= yaml.FlowStyle
+		for _, child := range n.Content {
+			resetStyle(child)
+		}
+	}
+	resetStyle(node)
+
+	return node, nil
+}
+
+func yamlRoot(document *yaml.Node) *yaml.Node {
+	if document.Kind == yaml.DocumentNode && len(document.Content) > 0 {
+		return document.Content[0]
+	}
+
+	return document
+}
+
+// yamlLookup follows the keys through nested mappings and returns nil if any of them is missing.
+func yamlLookup(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+
+	return node
+}
+
+func yamlString(node *yaml.Node, keys ...string) string {
+	if value := yamlLookup(node, keys...); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+
+	return ""
+}
+
+// yamlEnsure follows the keys like yamlLookup, creating the missing entries. The last one is
+// created with the given kind, the others as mappings.
+func yamlEnsure(node *yaml.Node, kind yaml.Kind, keys ...string) *yaml.Node {
+	for i, key := range keys {
+		next := yamlLookup(node, key)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			if i == len(keys)-1 {
+				next.Kind = kind
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, next)
+		}
+		node = next
+	}
+
+	return node
+}
+
+// upsertYamlItem replaces the first item of the sequence matching the predicate, or appends it.
+func upsertYamlItem(sequence *yaml.Node, item *yaml.Node, match func(*yaml.Node) bool) {
+	for i, existing := range sequence.Content {
+		if match(existing) {
+			sequence.Content[i] = item
+			return
+		}
+	}
+
+	sequence.Content = append(sequence.Content, item)
+}
+
+func readK8sRouteService(path string, appName string) (*K8sRouteService, error) {
+	documents, err := loadYamlDocuments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, document := range documents {
+		root := yamlRoot(document)
+		if yamlString(root, "kind") != "Service" {
+			continue
+		}
+
+		service := &K8sRouteService{
+			AppName: appName,
+			Name:    yamlString(root, "metadata", "name"),
+			File:    path,
+		}
+		if ports := yamlLookup(root, "spec", "ports"); ports != nil && len(ports.Content) > 0 {
+			service.Port, _ = strconv.Atoi(yamlString(ports.Content[0], "port"))
+		}
+
+		if service.Name == "" || service.Port == 0 {
+			return nil, fmt.Errorf("service in %s has no name or port", path)
+		}
+
+		return service, nil
+	}
+
+	return nil, fmt.Errorf("no service found in %s", path)
+}
+
+// ListK8sRouteServices returns the Services generated by 'ako k3d manifest create', either as raw
+// manifests or as a kustomize base.
+func ListK8sRouteServices() ([]K8sRouteService, error) {
+	services := make([]K8sRouteService, 0)
+	err := filepath.WalkDir(k8sManifestFolder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(k8sManifestFolder, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+
+		if d.IsDir() {
+			if len(parts) == 1 && slices.Contains(k8sManifestSkipFolders, parts[0]) && parts[0] != kustomizeBaseFolder {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		appName := ""
+		switch {
+		case parts[0] == kustomizeBaseFolder && len(parts) == 3 && d.Name() == k8sServiceFile:
+			appName = parts[1]
+		case parts[0] != kustomizeBaseFolder && len(parts) > 1 && d.Name() == k8sEnvRemote+"-"+k8sServiceFile:
+			appName = MakeCmdDepthToName(parts[:len(parts)-1]...)
+		default:
+			return nil
+		}
+
+		if slices.ContainsFunc(services, func(s K8sRouteService) bool { return s.AppName == appName }) {
+			return nil
+		}
+
+		service, err := readK8sRouteService(path, appName)
+		if err != nil {
+			return err
+		}
+		services = append(services, *service)
+
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no manifests found, run 'ako k3d manifest init' first")
+		}
+		return nil, err
+	}
+
+	return services, nil
+}
+
+func SelectK8sRouteService() (*K8sRouteService, error) {
+	services, err := ListK8sRouteServices()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services found, run 'ako k3d manifest create' for a deployment first")
+	}
+
+	options := make([]string, len(services))
+	for i, service := range services {
+		options[i] = fmt.Sprintf("%s (%s:%d)", service.AppName, service.Name, service.Port)
+	}
+
+	var selected int
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select the service to route to:",
+		Options: options,
+	}, &selected); err != nil {
+		return nil, err
+	}
+
+	return &services[selected], nil
+}
+
+// SelectK8sIngress selects one of the shared ingresses written by 'ako k3d manifest init'.
+func SelectK8sIngress() (string, error) {
+	entries, err := os.ReadDir(k8sManifestFolder)
+	if err != nil {
+		return "", err
+	}
+
+	ingresses := make([]string, 0, 2)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if _, err := os.Stat(filepath.Join(k8sManifestFolder, entry.Name(), k8sIngressFile)); err == nil {
+			ingresses = append(ingresses, entry.Name())
+		}
+	}
+
+	if len(ingresses) == 0 {
+		return "", fmt.Errorf("no ingress found, run 'ako k3d manifest init' first")
+	}
+
+	var selected string
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select the ingress to add the route to:",
+		Options: ingresses,
+	}, &selected, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	return selected, nil
+}
+
+func InputK8sRouteHostAndPath(appName string) (string, string, error) {
+	var host string
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the host (empty for any host):",
+		Default: "localhost",
+	}, &host); err != nil {
+		return "", "", err
+	}
+
+	path := "/" + appName
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the path prefix:",
+		Default: path,
+	}, &path, survey.WithValidator(func(ans interface{}) error {
+		if s, ok := ans.(string); !ok || !strings.HasPrefix(strings.TrimSpace(s), "/") {
+			return fmt.Errorf("path must start with /")
+		}
+		return nil
+	})); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(host), strings.TrimSpace(path), nil
+}
+
+// AddK8sRoute adds the route to the ingress's manifest of the given output, and returns the file
+// it wrote.
+func AddK8sRoute(output string, route K8sRoute) (string, error) {
+	switch output {
+	case K8sRouteOutputIngress:
+		return addK8sIngressRoute(route)
+	case K8sRouteOutputIngressRoute:
+		return addTraefikIngressRoute(route)
+	case K8sRouteOutputHTTPRoute:
+		return addGatewayHTTPRoute(route)
+	default:
+		return "", fmt.Errorf("unknown route output: %s, expected one of %s", output, strings.Join(K8sRouteOutputs, ", "))
+	}
+}
+
+func addK8sIngressRoute(route K8sRoute) (string, error) {
+	path := filepath.Join(k8sManifestFolder, route.Ingress, k8sIngressFile)
+	documents, err := loadYamlDocuments(path)
+	if err != nil {
+		return "", err
+	}
+
+	var ingress *yaml.Node
+	for _, document := range documents {
+		if yamlString(yamlRoot(document), "kind") == "Ingress" {
+			ingress = yamlRoot(document)
+			break
+		}
+	}
+	if ingress == nil {
+		return "", fmt.Errorf("no ingress found in %s", path)
+	}
+
+	rules := yamlEnsure(ingress, yaml.SequenceNode, "spec", "rules")
+
+	// Drop the placeholder backend, and the rules left without paths.
+	kept := make([]*yaml.Node, 0, len(rules.Content))
+	for _, rule := range rules.Content {
+		if paths := yamlLookup(rule, "http", "paths"); paths != nil {
+			paths.Content = slices.DeleteFunc(paths.Content, func(p *yaml.Node) bool {
+				return yamlString(p, "backend", "service", "name") == k8sIngressPlaceholderService
+			})
+			if len(paths.Content) == 0 {
+				continue
+			}
+		}
+		kept = append(kept, rule)
+	}
+	rules.Content = kept
+
+	var rule *yaml.Node
+	for _, r := range rules.Content {
+		if yamlString(r, "host") == route.Host {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		value := map[string]any{}
+		if route.Host != "" {
+			value["host"] = route.Host
+		}
+		rule, err = yamlNodeOf(value)
+		if err != nil {
+			return "", err
+		}
+		rules.Content = append(rules.Content, rule)
+	}
+
+	item, err := yamlNodeOf(k8sIngressPath{
+		Path:     route.Path,
+		PathType: "Prefix",
+		Backend: map[string]any{
+			"service": map[string]any{
+				"name": route.Service.Name,
+				"port": map[string]any{"number": route.Service.Port},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	paths := yamlEnsure(rule, yaml.SequenceNode, "http", "paths")
+	upsertYamlItem(paths, item, func(p *yaml.Node) bool {
+		return yamlString(p, "path") == route.Path
+	})
+
+	return path, writeYamlDocuments(path, documents)
+}
+
+func traefikRouteMatch(host string, path string) string {
+	match := fmt.Sprintf("PathPrefix(`%s`)", path)
+	if host != "" {
+		match = fmt.Sprintf("Host(`%s`) && %s", host, match)
+	}
+
+	return match
+}
+
+func addTraefikIngressRoute(route K8sRoute) (string, error) {
+	path := filepath.Join(k8sManifestFolder, route.Ingress, k8sIngressRouteFile)
+	documents, err := loadYamlDocuments(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if len(documents) == 0 {
+		document, err := yamlNodeOf(map[string]any{
+			"apiVersion": "traefik.io/v1alpha1",
+			"kind":       "IngressRoute",
+			"metadata": map[string]any{
+				"name":      route.Ingress + "-ingressroute",
+				"namespace": GlobalConfig.Namespace,
+			},
+			"spec": map[string]any{
+				"entryPoints": []string{"web"},
+				"routes":      []any{},
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		documents = append(documents, document)
+	}
+
+	match := traefikRouteMatch(route.Host, route.Path)
+	item, err := yamlNodeOf(map[string]any{
+		"match": match,
+		"kind":  "Rule",
+		"services": []any{
+			map[string]any{"name": route.Service.Name, "port": route.Service.Port},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	routes := yamlEnsure(yamlRoot(documents[0]), yaml.SequenceNode, "spec", "routes")
+	upsertYamlItem(routes, item, func(r *yaml.Node) bool {
+		return yamlString(r, "match") == match
+	})
+
+	return path, writeYamlDocuments(path, documents)
+}
+
+const k8sGatewayTemplate = `apiVersion: gateway.networking.k8s.io/v1
+kind: Gateway
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+spec:
+  gatewayClassName: {{ .ClassName }}
+  listeners:
+  - name: http
+    port: 80
+    protocol: HTTP
+    allowedRoutes:
+      namespaces:
+        from: Same
+`
+
+type k8sGatewayData struct {
+	Name      string
+	Namespace string
+	ClassName string
+}
+
+func getK8sGatewayName(ingress string) string {
+	return ingress + "-gateway"
+}
+
+// writeK8sGatewayFile writes the Gateway the ingress's HTTPRoutes attach to, unless it exists.
+func writeK8sGatewayFile(ingress string) error {
+	path := filepath.Join(k8sManifestFolder, ingress, k8sGatewayFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return template.WriteTemplate2File(path, k8sGatewayTemplate, k8sGatewayData{
+		Name:      getK8sGatewayName(ingress),
+		Namespace: GlobalConfig.Namespace,
+		ClassName: k8sGatewayClassName,
+	})
+}
+
+// addGatewayHTTPRoute keeps one HTTPRoute per host in the ingress's httproute.yaml, since the
+// hostnames of an HTTPRoute apply to all of its rules.
+func addGatewayHTTPRoute(route K8sRoute) (string, error) {
+	path := filepath.Join(k8sManifestFolder, route.Ingress, k8sHTTPRouteFile)
+	documents, err := loadYamlDocuments(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var httpRoute *yaml.Node
+	for _, document := range documents {
+		root := yamlRoot(document)
+		hostnames := yamlLookup(root, "spec", "hostnames")
+		if route.Host == "" && (hostnames == nil || len(hostnames.Content) == 0) ||
+			hostnames != nil && len(hostnames.Content) == 1 && hostnames.Content[0].Value == route.Host {
+			httpRoute = root
+			break
+		}
+	}
+
+	if httpRoute == nil {
+		name := route.Ingress + "-route"
+		spec := map[string]any{
+			"parentRefs": []any{map[string]any{"name": getK8sGatewayName(route.Ingress)}},
+			"rules":      []any{},
+		}
+		if route.Host != "" {
+			name = route.Ingress + "-" + strings.ReplaceAll(route.Host, ".", "-") + "-route"
+			spec["hostnames"] = []string{route.Host}
+		}
+
+		document, err := yamlNodeOf(map[string]any{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "HTTPRoute",
+			"metadata": map[string]any{
+				"name":      name,
+				"namespace": GlobalConfig.Namespace,
+			},
+			"spec": spec,
+		})
+		if err != nil {
+			return "", err
+		}
+		documents = append(documents, document)
+		httpRoute = yamlRoot(document)
+	}
+
+	item, err := yamlNodeOf(map[string]any{
+		"matches": []any{
+			map[string]any{"path": map[string]any{"type": "PathPrefix", "value": route.Path}},
+		},
+		"backendRefs": []any{
+			map[string]any{"name": route.Service.Name, "port": route.Service.Port},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	rules := yamlEnsure(httpRoute, yaml.SequenceNode, "spec", "rules")
+	upsertYamlItem(rules, item, func(r *yaml.Node) bool {
+		matches := yamlLookup(r, "matches")
+		return matches != nil && len(matches.Content) == 1 && yamlString(matches.Content[0], "path", "value") == route.Path
+	})
+
+	if err := writeYamlDocuments(path, documents); err != nil {
+		return "", err
+	}
+
+	return path, writeK8sGatewayFile(route.Ingress)
+}
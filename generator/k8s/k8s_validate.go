@@ -0,0 +1,478 @@
+package k8s
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gosuda/ako/util/table"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	K8sValidationLevelError   = "error"
+	K8sValidationLevelWarning = "warning"
+)
+
+const (
+	k8sRuleParse           = "parse"
+	k8sRuleSchema          = "schema"
+	k8sRuleAPIVersion      = "api-version"
+	k8sRuleResourceLimits  = "resource-limits"
+	k8sRuleImageTag        = "image-tag"
+	k8sRuleSelectorLabels  = "selector-labels"
+	k8sRuleServiceSelector = "service-selector"
+)
+
+// K8sServedAPIsVersion is the Kubernetes version whose served apiVersions manifests are checked
+// against by default. The bundled schemas themselves are a single set, of the current apiVersions.
+const K8sServedAPIsVersion = "1.33"
+
+const k8sSchemaURL = "file:///schemas/k8s.json"
+
+//go:embed schemas/k8s.json
+var k8sSchemaFS embed.FS
+
+// k8sAPI records when an apiVersion of a kind was served. The bundled schemas only describe the
+// current apiVersions, so older ones are checked against this table instead.
+type k8sAPI struct {
+	apiVersion  string
+	kind        string
+	introduced  int
+	removed     int
+	replacement string
+}
+
+var k8sAPIs = []k8sAPI{
+	{apiVersion: "batch/v1", kind: "CronJob", introduced: 21},
+	{apiVersion: "batch/v1beta1", kind: "CronJob", removed: 25, replacement: "batch/v1"},
+	{apiVersion: "policy/v1", kind: "PodDisruptionBudget", introduced: 21},
+	{apiVersion: "policy/v1beta1", kind: "PodDisruptionBudget", removed: 25, replacement: "policy/v1"},
+	{apiVersion: "autoscaling/v2", kind: "HorizontalPodAutoscaler", introduced: 23},
+	{apiVersion: "autoscaling/v2beta1", kind: "HorizontalPodAutoscaler", removed: 25, replacement: "autoscaling/v2"},
+	{apiVersion: "autoscaling/v2beta2", kind: "HorizontalPodAutoscaler", removed: 26, replacement: "autoscaling/v2"},
+	{apiVersion: "networking.k8s.io/v1", kind: "Ingress", introduced: 19},
+	{apiVersion: "networking.k8s.io/v1beta1", kind: "Ingress", removed: 22, replacement: "networking.k8s.io/v1"},
+	{apiVersion: "extensions/v1beta1", kind: "Ingress", removed: 22, replacement: "networking.k8s.io/v1"},
+	{apiVersion: "extensions/v1beta1", kind: "Deployment", removed: 16, replacement: "apps/v1"},
+	{apiVersion: "extensions/v1beta1", kind: "DaemonSet", removed: 16, replacement: "apps/v1"},
+	{apiVersion: "extensions/v1beta1", kind: "NetworkPolicy", removed: 16, replacement: "networking.k8s.io/v1"},
+	{apiVersion: "apps/v1beta1", kind: "Deployment", removed: 16, replacement: "apps/v1"},
+	{apiVersion: "apps/v1beta2", kind: "Deployment", removed: 16, replacement: "apps/v1"},
+	{apiVersion: "apps/v1beta1", kind: "StatefulSet", removed: 16, replacement: "apps/v1"},
+	{apiVersion: "apps/v1beta2", kind: "StatefulSet", removed: 16, replacement: "apps/v1"},
+}
+
+type K8sValidationIssue struct {
+	File    string
+	Kind    string
+	Name    string
+	Level   string
+	Rule    string
+	Message string
+}
+
+type k8sObject struct {
+	file      string
+	kind      string
+	name      string
+	namespace string
+	object    map[string]any
+	raw       []byte
+}
+
+func (o k8sObject) issue(level string, rule string, format string, args ...any) K8sValidationIssue {
+	return K8sValidationIssue{
+		File:    o.file,
+		Kind:    o.kind,
+		Name:    o.name,
+		Level:   level,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// parseK8sMinorVersion accepts versions such as 1.33, v1.33 or 1.33.2 and returns the minor.
+func parseK8sMinorVersion(version string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, fmt.Errorf("invalid kubernetes version %q, expected 1.<minor>", version)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid kubernetes version %q, expected 1.<minor>", version)
+	}
+
+	return minor, nil
+}
+
+// ValidateK8sManifests checks every manifest against the bundled schemas and the best practices,
+// and that its apiVersion is served by the Kubernetes version, without accessing any cluster.
+func ValidateK8sManifests(servedBy string) ([]K8sValidationIssue, error) {
+	minor, err := parseK8sMinorVersion(servedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := GetK8sManifestList(k8sManifestFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := newK8sSchemaValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make([]K8sValidationIssue, 0)
+	objects := make([]k8sObject, 0, len(files))
+	for _, file := range files {
+		loaded, err := loadK8sObjects(filepath.Join(k8sManifestFolder, file))
+		if err != nil {
+			issues = append(issues, K8sValidationIssue{File: file, Level: K8sValidationLevelError, Rule: k8sRuleParse, Message: err.Error()})
+			continue
+		}
+		objects = append(objects, loaded...)
+	}
+
+	for _, object := range objects {
+		issues = append(issues, validator.validate(object, minor)...)
+		issues = append(issues, lintK8sWorkload(object)...)
+	}
+	issues = append(issues, lintK8sServiceSelectors(objects)...)
+
+	return issues, nil
+}
+
+func loadK8sObjects(file string) ([]k8sObject, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	objects := make([]k8sObject, 0, 1)
+	decoder := yaml.NewDecoder(f)
+	for {
+		var document any
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if document == nil {
+			continue
+		}
+
+		// The schemas describe JSON, so the document goes through JSON to get its types.
+		raw, err := json.Marshal(document)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(objects)+1, err)
+		}
+
+		var object map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, fmt.Errorf("document %d is not an object", len(objects)+1)
+		}
+
+		name, _ := k8sLookup(object, "metadata", "name").(string)
+		namespace, _ := k8sLookup(object, "metadata", "namespace").(string)
+		kind, _ := object["kind"].(string)
+		objects = append(objects, k8sObject{file: file, kind: kind, name: name, namespace: namespace, object: object, raw: raw})
+	}
+
+	return objects, nil
+}
+
+// k8sLookup returns the value at the path of nested objects, or nil.
+func k8sLookup(object map[string]any, path ...string) any {
+	var value any = object
+	for _, key := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+
+	return value
+}
+
+type k8sSchemaValidator struct {
+	compiler *jsonschema.Compiler
+	schemas  map[string]*jsonschema.Schema
+	defs     map[string]struct{}
+}
+
+func newK8sSchemaValidator() (*k8sSchemaValidator, error) {
+	raw, err := k8sSchemaFS.ReadFile("schemas/k8s.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if err := json.Unmarshal(raw, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundled schemas: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource(k8sSchemaURL, bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid bundled schemas: %w", err)
+	}
+
+	defs := make(map[string]struct{}, len(bundle.Defs))
+	for def := range bundle.Defs {
+		defs[def] = struct{}{}
+	}
+
+	return &k8sSchemaValidator{
+		compiler: compiler,
+		schemas:  map[string]*jsonschema.Schema{},
+		defs:     defs,
+	}, nil
+}
+
+func (v *k8sSchemaValidator) validate(object k8sObject, minor int) []K8sValidationIssue {
+	apiVersion, _ := object.object["apiVersion"].(string)
+	if apiVersion == "" || object.kind == "" {
+		return []K8sValidationIssue{object.issue(K8sValidationLevelError, k8sRuleSchema, "apiVersion and kind are required")}
+	}
+
+	for _, api := range k8sAPIs {
+		if api.apiVersion != apiVersion || api.kind != object.kind {
+			continue
+		}
+		if api.removed != 0 && minor >= api.removed {
+			return []K8sValidationIssue{object.issue(K8sValidationLevelError, k8sRuleAPIVersion,
+				"%s %s was removed in 1.%d, use %s", apiVersion, object.kind, api.removed, api.replacement)}
+		}
+		if api.introduced != 0 && minor < api.introduced {
+			return []K8sValidationIssue{object.issue(K8sValidationLevelError, k8sRuleAPIVersion,
+				"%s %s is not served before 1.%d", apiVersion, object.kind, api.introduced)}
+		}
+	}
+
+	key := strings.ReplaceAll(apiVersion, "/", ".") + "." + object.kind
+	if _, ok := v.defs[key]; !ok {
+		if i := slices.IndexFunc(k8sAPIs, func(api k8sAPI) bool {
+			return api.apiVersion == apiVersion && api.kind == object.kind && api.replacement != ""
+		}); i >= 0 {
+			return []K8sValidationIssue{object.issue(K8sValidationLevelWarning, k8sRuleAPIVersion,
+				"%s %s is deprecated and removed in 1.%d, use %s", apiVersion, object.kind, k8sAPIs[i].removed, k8sAPIs[i].replacement)}
+		}
+		return []K8sValidationIssue{object.issue(K8sValidationLevelWarning, k8sRuleSchema,
+			"no bundled schema for %s %s, skipped", apiVersion, object.kind)}
+	}
+
+	schema, ok := v.schemas[key]
+	if !ok {
+		var err error
+		schema, err = v.compiler.Compile(k8sSchemaURL + "#/$defs/" + key)
+		if err != nil {
+			return []K8sValidationIssue{object.issue(K8sValidationLevelError, k8sRuleSchema, "compile schema: %v", err)}
+		}
+		v.schemas[key] = schema
+	}
+
+	err := schema.Validate(object.object)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []K8sValidationIssue{object.issue(K8sValidationLevelError, k8sRuleSchema, "%v", err)}
+	}
+
+	causes := k8sValidationLeaves(validationErr)
+	slices.SortStableFunc(causes, func(a, b *jsonschema.ValidationError) int {
+		return strings.Compare(a.InstanceLocation, b.InstanceLocation)
+	})
+
+	issues := make([]K8sValidationIssue, 0, len(causes))
+	for _, cause := range causes {
+		location := cause.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		issue := object.issue(K8sValidationLevelError, k8sRuleSchema, "%s: %s", location, cause.Message)
+		if !slices.Contains(issues, issue) {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// k8sValidationLeaves returns the innermost causes, which point at the offending fields.
+func k8sValidationLeaves(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	leaves := make([]*jsonschema.ValidationError, 0, len(err.Causes))
+	for _, cause := range err.Causes {
+		leaves = append(leaves, k8sValidationLeaves(cause)...)
+	}
+
+	return leaves
+}
+
+// k8sPodTemplate returns the pod template of a workload, or nil for other kinds.
+func k8sPodTemplate(object k8sObject) map[string]any {
+	var template any
+	switch object.kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "Job", "ReplicaSet":
+		template = k8sLookup(object.object, "spec", "template")
+	case "CronJob":
+		template = k8sLookup(object.object, "spec", "jobTemplate", "spec", "template")
+	}
+
+	m, _ := template.(map[string]any)
+	return m
+}
+
+func lintK8sWorkload(object k8sObject) []K8sValidationIssue {
+	template := k8sPodTemplate(object)
+	if template == nil {
+		return nil
+	}
+
+	issues := make([]K8sValidationIssue, 0)
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := k8sLookup(template, "spec", field).([]any)
+		for _, c := range containers {
+			container, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			containerName, _ := container["name"].(string)
+
+			for _, resource := range []string{"cpu", "memory"} {
+				if k8sLookup(container, "resources", "limits", resource) == nil {
+					issues = append(issues, object.issue(K8sValidationLevelWarning, k8sRuleResourceLimits,
+						"container %s has no %s limit", containerName, resource))
+				}
+			}
+
+			image, _ := container["image"].(string)
+			switch tag := k8sImageTag(image); tag {
+			case "":
+				issues = append(issues, object.issue(K8sValidationLevelWarning, k8sRuleImageTag,
+					"container %s image %s has no tag", containerName, image))
+			case "latest":
+				issues = append(issues, object.issue(K8sValidationLevelWarning, k8sRuleImageTag,
+					"container %s image %s uses the latest tag", containerName, image))
+			}
+		}
+	}
+
+	// Jobs and CronJobs generate their selector, so only the labels of other workloads are checked.
+	if object.kind == "Job" || object.kind == "CronJob" {
+		return issues
+	}
+
+	matchLabels, _ := k8sLookup(object.object, "spec", "selector", "matchLabels").(map[string]any)
+	labels, _ := k8sLookup(template, "metadata", "labels").(map[string]any)
+	for _, key := range slices.Sorted(maps.Keys(matchLabels)) {
+		if labels[key] != matchLabels[key] {
+			issues = append(issues, object.issue(K8sValidationLevelError, k8sRuleSelectorLabels,
+				"selector %s=%v does not match the pod template labels", key, matchLabels[key]))
+		}
+	}
+
+	return issues
+}
+
+// k8sImageTag returns the tag of the image, or "digest" when it is pinned by digest.
+func k8sImageTag(image string) string {
+	if strings.Contains(image, "@") {
+		return "digest"
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return ""
+}
+
+// lintK8sServiceSelectors reports Services whose selector matches the pods of no workload in the
+// same namespace.
+func lintK8sServiceSelectors(objects []k8sObject) []K8sValidationIssue {
+	issues := make([]K8sValidationIssue, 0)
+	for _, service := range objects {
+		if service.kind != "Service" {
+			continue
+		}
+
+		selector, _ := k8sLookup(service.object, "spec", "selector").(map[string]any)
+		if len(selector) == 0 {
+			continue
+		}
+		matched := slices.ContainsFunc(objects, func(workload k8sObject) bool {
+			template := k8sPodTemplate(workload)
+			if template == nil {
+				return false
+			}
+			if workload.namespace != service.namespace {
+				return false
+			}
+
+			labels, _ := k8sLookup(template, "metadata", "labels").(map[string]any)
+			for key, value := range selector {
+				if labels[key] != value {
+					return false
+				}
+			}
+			return true
+		})
+		if !matched {
+			issues = append(issues, service.issue(K8sValidationLevelWarning, k8sRuleServiceSelector,
+				"selector %s matches no workload", formatK8sSelector(selector)))
+		}
+	}
+
+	return issues
+}
+
+func formatK8sSelector(selector map[string]any) string {
+	pairs := make([]string, 0, len(selector))
+	for _, key := range slices.Sorted(maps.Keys(selector)) {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, selector[key]))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func HasK8sValidationErrors(issues []K8sValidationIssue) bool {
+	return slices.ContainsFunc(issues, func(issue K8sValidationIssue) bool {
+		return issue.Level == K8sValidationLevelError
+	})
+}
+
+func PrintK8sValidationIssues(issues []K8sValidationIssue) {
+	tbl := table.NewTableBuilder("FILE", "KIND", "NAME", "LEVEL", "RULE", "MESSAGE")
+	for _, issue := range issues {
+		tbl.AppendRow(issue.File, issue.Kind, issue.Name, issue.Level, issue.Rule, issue.Message)
+	}
+	tbl.Print()
+}
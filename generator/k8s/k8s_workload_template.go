@@ -0,0 +1,534 @@
+package k8s
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/AlecAivazis/survey/v2"
+
+	"github.com/gosuda/ako/util/template"
+)
+
+// k8sWorkloads maps the workload manifest kinds to the apiVersion, object kind and name suffix of
+// the object they generate, for the manifests referring to it.
+var k8sWorkloads = map[string]struct {
+	apiVersion string
+	kind       string
+	suffix     string
+	replicas   bool
+}{
+	K8sManifestKindDeployment:  {apiVersion: "apps/v1", kind: "Deployment", suffix: "-deployment", replicas: true},
+	K8sManifestKindStatefulSet: {apiVersion: "apps/v1", kind: "StatefulSet", suffix: "-statefulset", replicas: true},
+	K8sManifestKindDaemonSet:   {apiVersion: "apps/v1", kind: "DaemonSet", suffix: "-daemonset"},
+	K8sManifestKindJob:         {apiVersion: "batch/v1", kind: "Job", suffix: "-job"},
+}
+
+func InputK8sResources() (*K8sResources, error) {
+	resources := &K8sResources{}
+	prompts := []struct {
+		message string
+		value   string
+		target  *string
+	}{
+		{"Enter the memory request:", "256Mi", &resources.Requests.Memory},
+		{"Enter the CPU request:", "500m", &resources.Requests.CPU},
+		{"Enter the memory limit:", "1Gi", &resources.Limits.Memory},
+		{"Enter the CPU limit:", "1", &resources.Limits.CPU},
+	}
+
+	for _, prompt := range prompts {
+		if err := survey.AskOne(&survey.Input{
+			Message: prompt.message,
+			Default: prompt.value,
+		}, prompt.target, survey.WithValidator(survey.Required)); err != nil {
+			return nil, err
+		}
+	}
+
+	return resources, nil
+}
+
+// GenerateK8sWorkloadFile writes the manifest of a StatefulSet, Job or DaemonSet.
+func GenerateK8sWorkloadFile(kind string, tier string, resources *K8sResources, namespace string, cmdDepth ...string) error {
+	switch kind {
+	case K8sManifestKindStatefulSet:
+		return GenerateK8sStatefulSetFile(tier, resources, namespace, cmdDepth...)
+	case K8sManifestKindJob:
+		return GenerateK8sJobFile(tier, resources, namespace, cmdDepth...)
+	case K8sManifestKindDaemonSet:
+		return GenerateK8sDaemonSetFile(tier, resources, namespace, cmdDepth...)
+	default:
+		return fmt.Errorf("unknown workload kind: %s", kind)
+	}
+}
+
+func writeK8sManifestFile(env string, typ string, tmpl string, data any, cmdDepth ...string) error {
+	filePath := makeK8sManifestFile(env, typ, cmdDepth...)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	return template.WriteTemplate2File(filePath, tmpl, data)
+}
+
+func getK8sImage(registry string, appName string) string {
+	return registry + "/" + GlobalConfig.Namespace + "/" + appName
+}
+
+const k8sStatefulSetTemplate = `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: {{ .AppName }}-statefulset
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+    tier: {{ .Tier }}
+    version: {{ .Version }}
+  annotations:
+    kubernetes.io/change-cause: "{{ .ChangeCause }}"
+spec:
+  serviceName: {{ .AppName }}-headless
+  replicas: {{ .Replicas }}
+  selector:
+    matchLabels:
+      app: {{ .AppName }}
+  template:
+    metadata:
+      labels:
+        app: {{ .AppName }}
+        tier: {{ .Tier }}
+      {{- template "podHealthAnnotations" . }}
+    spec:
+      {{- template "podHealthSpec" . }}
+      containers:
+      - name: {{ .ContainerName }}
+        image: {{ .Image }}:{{ .Tag }}
+        ports:
+        - name: http
+          containerPort: {{ .Port }}
+        {{- template "containerHealth" . }}
+        {{- if .Resources }}
+        resources:
+          requests:
+            memory: "{{ .Resources.Requests.Memory }}"
+            cpu: "{{ .Resources.Requests.CPU }}"
+          limits:
+            memory: "{{ .Resources.Limits.Memory }}"
+            cpu: "{{ .Resources.Limits.CPU }}"
+        {{- end }}
+        envFrom:
+        - configMapRef:
+            name: {{ .AppName }}-configmap
+        - secretRef:
+            name: {{ .AppName }}-secret
+            optional: true
+        volumeMounts:
+        - name: data
+          mountPath: {{ .MountPath }}
+  volumeClaimTemplates:
+  - metadata:
+      name: data
+    spec:
+      accessModes:
+        - ReadWriteOnce
+      {{- if .StorageClassName }}
+      storageClassName: {{ .StorageClassName }}
+      {{- end }}
+      resources:
+        requests:
+          storage: {{ .StorageSize }}
+` + k8sHealthTemplates
+
+const k8sHeadlessServiceTemplate = `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .AppName }}-headless
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+spec:
+  clusterIP: None
+  selector:
+    app: {{ .AppName }}
+  ports:
+    - name: http
+      protocol: TCP
+      port: {{ .TargetPort }}
+      targetPort: {{ .TargetPort }}
+`
+
+type K8sStatefulSetData struct {
+	AppName          string
+	Namespace        string
+	Tier             string
+	Version          string
+	ChangeCause      string
+	Replicas         int
+	ContainerName    string
+	Image            string
+	Tag              string
+	Port             int
+	Resources        *K8sResources
+	MountPath        string
+	StorageSize      string
+	StorageClassName string
+	Health           *K8sHealth
+}
+
+func newK8sStatefulSetData(tier string, namespace string, appName string, resources *K8sResources) K8sStatefulSetData {
+	return K8sStatefulSetData{
+		AppName:          appName,
+		Namespace:        namespace,
+		Tier:             tier,
+		Version:          "v1.0.0",
+		ChangeCause:      "Initial deployment",
+		Replicas:         getK8sTierPolicy(tier).Replicas,
+		ContainerName:    appName,
+		Tag:              "latest",
+		Port:             8080,
+		Resources:        resources,
+		Health:           newK8sHealth(),
+		MountPath:        "/data",
+		StorageSize:      "1Gi",
+		StorageClassName: "standard",
+	}
+}
+
+func newK8sHeadlessServiceData(namespace string, appName string) K8sServiceData {
+	return K8sServiceData{
+		AppName:    appName,
+		Namespace:  namespace,
+		TargetPort: 8080,
+	}
+}
+
+// GenerateK8sStatefulSetFile writes a StatefulSet with a volume claim per replica, and the headless
+// Service that gives each replica a stable network identity.
+func GenerateK8sStatefulSetFile(tier string, resources *K8sResources, namespace string, cmdDepth ...string) error {
+	appName := MakeCmdDepthToName(cmdDepth...)
+	data := newK8sStatefulSetData(tier, namespace, appName, resources)
+	serviceData := newK8sHeadlessServiceData(namespace, appName)
+
+	for _, env := range []string{k8sEnvRemote, k8sEnvLocal} {
+		registry := GlobalConfig.RemoteRegistry
+		if env == k8sEnvLocal {
+			registry = GlobalConfig.LocalRegistry
+		}
+		data.Image = getK8sImage(registry, appName)
+
+		if err := writeK8sManifestFile(env, k8sStatefulSetFile, k8sStatefulSetTemplate, data, cmdDepth...); err != nil {
+			return err
+		}
+
+		if err := writeK8sManifestFile(env, k8sServiceFile, k8sHeadlessServiceTemplate, serviceData, cmdDepth...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const k8sJobTemplate = `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .AppName }}-job
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+    tier: {{ .Tier }}
+    job-type: one-shot
+  annotations:
+    description: "{{ .Description }}"
+spec:
+  backoffLimit: {{ .BackoffLimit }}
+  ttlSecondsAfterFinished: {{ .TTLSecondsAfterFinished }}
+  template:
+    metadata:
+      labels:
+        app: {{ .AppName }}
+        tier: {{ .Tier }}
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: {{ .ContainerName }}
+        image: {{ .Image }}:{{ .Tag }}
+        {{- if .Args }}
+        args:
+        {{- range .Args }}
+        - "{{ . }}"
+        {{- end }}
+        {{- end }}
+        {{- if .Resources }}
+        resources:
+          requests:
+            memory: "{{ .Resources.Requests.Memory }}"
+            cpu: "{{ .Resources.Requests.CPU }}"
+          limits:
+            memory: "{{ .Resources.Limits.Memory }}"
+            cpu: "{{ .Resources.Limits.CPU }}"
+        {{- end }}
+        envFrom:
+        - configMapRef:
+            name: {{ .AppName }}-configmap
+        - secretRef:
+            name: {{ .AppName }}-secret
+            optional: true
+`
+
+type K8sJobData struct {
+	AppName                 string
+	Namespace               string
+	Tier                    string
+	Description             string
+	ContainerName           string
+	Image                   string
+	Tag                     string
+	Args                    []string
+	Resources               *K8sResources
+	BackoffLimit            int
+	TTLSecondsAfterFinished int
+}
+
+func newK8sJobData(tier string, namespace string, appName string, resources *K8sResources) K8sJobData {
+	return K8sJobData{
+		AppName:                 appName,
+		Namespace:               namespace,
+		Tier:                    tier,
+		Description:             "One-shot job, such as a database migration",
+		ContainerName:           appName,
+		Tag:                     "latest",
+		Resources:               resources,
+		BackoffLimit:            2,
+		TTLSecondsAfterFinished: 3600,
+	}
+}
+
+// GenerateK8sJobFile writes a one-shot Job, such as a migration. Jobs are immutable, so delete the
+// finished Job before applying it again.
+func GenerateK8sJobFile(tier string, resources *K8sResources, namespace string, cmdDepth ...string) error {
+	appName := MakeCmdDepthToName(cmdDepth...)
+	data := newK8sJobData(tier, namespace, appName, resources)
+
+	for _, env := range []string{k8sEnvRemote, k8sEnvLocal} {
+		registry := GlobalConfig.RemoteRegistry
+		if env == k8sEnvLocal {
+			registry = GlobalConfig.LocalRegistry
+		}
+		data.Image = getK8sImage(registry, appName)
+
+		if err := writeK8sManifestFile(env, k8sJobFile, k8sJobTemplate, data, cmdDepth...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const k8sDaemonSetTemplate = `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: {{ .AppName }}-daemonset
+  namespace: {{ .Namespace }}
+  labels:
+    app: {{ .AppName }}
+    tier: {{ .Tier }}
+    version: {{ .Version }}
+  annotations:
+    kubernetes.io/change-cause: "{{ .ChangeCause }}"
+spec:
+  selector:
+    matchLabels:
+      app: {{ .AppName }}
+  updateStrategy:
+    type: RollingUpdate
+    rollingUpdate:
+      maxUnavailable: 1
+  template:
+    metadata:
+      labels:
+        app: {{ .AppName }}
+        tier: {{ .Tier }}
+      {{- template "podHealthAnnotations" . }}
+    spec:
+      {{- template "podHealthSpec" . }}
+      containers:
+      - name: {{ .ContainerName }}
+        image: {{ .Image }}:{{ .Tag }}
+        ports:
+        - name: http
+          containerPort: {{ .Port }}
+        {{- template "containerHealth" . }}
+        {{- if .Resources }}
+        resources:
+          requests:
+            memory: "{{ .Resources.Requests.Memory }}"
+            cpu: "{{ .Resources.Requests.CPU }}"
+          limits:
+            memory: "{{ .Resources.Limits.Memory }}"
+            cpu: "{{ .Resources.Limits.CPU }}"
+        {{- end }}
+        envFrom:
+        - configMapRef:
+            name: {{ .AppName }}-configmap
+        - secretRef:
+            name: {{ .AppName }}-secret
+            optional: true
+` + k8sHealthTemplates
+
+type K8sDaemonSetData struct {
+	AppName       string
+	Namespace     string
+	Tier          string
+	Version       string
+	ChangeCause   string
+	ContainerName string
+	Image         string
+	Tag           string
+	Port          int
+	Resources     *K8sResources
+	Health        *K8sHealth
+}
+
+func newK8sDaemonSetData(tier string, namespace string, appName string, resources *K8sResources) K8sDaemonSetData {
+	return K8sDaemonSetData{
+		AppName:       appName,
+		Namespace:     namespace,
+		Tier:          tier,
+		Version:       "v1.0.0",
+		ChangeCause:   "Initial deployment",
+		ContainerName: appName,
+		Tag:           "latest",
+		Port:          8080,
+		Resources:     resources,
+		Health:        newK8sHealth(),
+	}
+}
+
+func GenerateK8sDaemonSetFile(tier string, resources *K8sResources, namespace string, cmdDepth ...string) error {
+	appName := MakeCmdDepthToName(cmdDepth...)
+	data := newK8sDaemonSetData(tier, namespace, appName, resources)
+
+	for _, env := range []string{k8sEnvRemote, k8sEnvLocal} {
+		registry := GlobalConfig.RemoteRegistry
+		if env == k8sEnvLocal {
+			registry = GlobalConfig.LocalRegistry
+		}
+		data.Image = getK8sImage(registry, appName)
+
+		if err := writeK8sManifestFile(env, k8sDaemonSetFile, k8sDaemonSetTemplate, data, cmdDepth...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const k8sSecretTemplate = `apiVersion: v1
+kind: Secret
+metadata:
+  name: {{ .Name }}-secret
+  {{- if .Namespace }}
+  namespace: {{ .Namespace }}
+  {{- end }}
+  labels:
+    app: {{ .Name }}
+type: Opaque
+stringData:
+  {{- range $key, $value := .Data }}
+  {{ $key }}: {{ quote $value }}
+  {{- end }}
+`
+
+type K8sSecretData struct {
+	Name      string
+	Namespace string
+	Data      map[string]string
+}
+
+// k8sExternalSecretStore is the ClusterSecretStore the generated ExternalSecrets read from, to be
+// renamed to the store of the cluster.
+const k8sExternalSecretStore = "secret-store"
+
+const k8sExternalSecretTemplate = `apiVersion: external-secrets.io/v1beta1
+kind: ExternalSecret
+metadata:
+  name: {{ .Name }}-secret
+  {{- if .Namespace }}
+  namespace: {{ .Namespace }}
+  {{- end }}
+  labels:
+    app: {{ .Name }}
+spec:
+  refreshInterval: 1h
+  secretStoreRef:
+    kind: ClusterSecretStore
+    name: {{ .Store }}
+  target:
+    name: {{ .Name }}-secret
+    creationPolicy: Owner
+  data:
+  {{- range .Keys }}
+  - secretKey: {{ . }}
+    remoteRef:
+      key: {{ $.Namespace }}/{{ $.Name }}
+      property: {{ . }}
+  {{- end }}
+`
+
+type K8sExternalSecretData struct {
+	Name      string
+	Namespace string
+	Store     string
+	Keys      []string
+}
+
+func newK8sSecretData(namespace string, appName string) (K8sSecretData, K8sExternalSecretData) {
+	local := K8sSecretData{
+		Name:      appName,
+		Namespace: namespace,
+		Data:      map[string]string{"password": "local-password"},
+	}
+
+	remote := K8sExternalSecretData{
+		Name:      appName,
+		Namespace: namespace,
+		Store:     k8sExternalSecretStore,
+		Keys:      slices.Sorted(maps.Keys(local.Data)),
+	}
+
+	return local, remote
+}
+
+// GenerateK8sSecretFile writes the Secret the workloads load with envFrom. The local cluster gets a
+// Secret with development values, the remote one an ExternalSecret that syncs the real values from
+// the secret store, so no placeholder can be applied over them. Files that exist are left as edited.
+func GenerateK8sSecretFile(namespace string, cmdDepth ...string) error {
+	local, remote := newK8sSecretData(namespace, MakeCmdDepthToName(cmdDepth...))
+
+	files := []struct {
+		env  string
+		typ  string
+		tmpl string
+		data any
+	}{
+		{k8sEnvLocal, k8sSecretFile, k8sSecretTemplate, local},
+		{k8sEnvRemote, k8sExternalSecretFile, k8sExternalSecretTemplate, remote},
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(makeK8sManifestFile(file.env, file.typ, cmdDepth...)); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := writeK8sManifestFile(file.env, file.typ, file.tmpl, file.data, cmdDepth...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
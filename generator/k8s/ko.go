@@ -1,6 +1,14 @@
 package k8s
 
-import "github.com/gosuda/ako/util/module"
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/gosuda/ako/util/module"
+)
 
 const (
 	koToolDependency = `github.com/google/ko`
@@ -26,3 +34,26 @@ func BuildKo(option KoBuildOption) error {
 
 	return nil
 }
+
+// BuildKoImageForDev builds the cmd at path with ko for the platform of the k3d nodes, pushes it to
+// the local registry and returns the image pinned by digest as pods pull it.
+func BuildKoImageForDev(path string, cmdDepth ...string) (string, error) {
+	pushHost := GetLocalRegistryPushHost()
+	repository := pushHost + "/" + GlobalConfig.Namespace + "/" + MakeCmdDepthToName(cmdDepth...)
+
+	cmd := exec.Command("go", "tool", koToolName, "build", path, "--bare", "--platform=linux/"+runtime.GOARCH)
+	cmd.Env = append(os.Environ(), "KO_DOCKER_REPO="+repository)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	// ko prints the pushed image as the last line.
+	lines := strings.Fields(string(output))
+	if len(lines) == 0 || !strings.HasPrefix(lines[len(lines)-1], repository+"@") {
+		return "", fmt.Errorf("ko did not report the pushed image of %s", path)
+	}
+
+	return GlobalConfig.LocalRegistry + strings.TrimPrefix(lines[len(lines)-1], pushHost), nil
+}
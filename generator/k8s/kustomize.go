@@ -0,0 +1,527 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/AlecAivazis/survey/v2"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/gosuda/ako/util/template"
+)
+
+const (
+	kustomizeBaseFolder     = "base"
+	kustomizeOverlayFolder  = "overlays"
+	kustomizePatchFolder    = "patches"
+	kustomizeSecretFolder   = "secrets"
+	kustomizationFileName   = "kustomization.yaml"
+	kustomizationAPIVersion = "kustomize.config.k8s.io/v1beta1"
+	kustomizationKind       = "Kustomization"
+)
+
+type KustomizeImage struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+}
+
+type KustomizeReplica struct {
+	Name  string `yaml:"name"`
+	Count int    `yaml:"count"`
+}
+
+type KustomizePatch struct {
+	Path string `yaml:"path"`
+}
+
+type KustomizeSecretGenerator struct {
+	Name     string   `yaml:"name"`
+	Literals []string `yaml:"literals,omitempty"`
+}
+
+type Kustomization struct {
+	APIVersion      string                     `yaml:"apiVersion"`
+	Kind            string                     `yaml:"kind"`
+	Namespace       string                     `yaml:"namespace,omitempty"`
+	Resources       []string                   `yaml:"resources,omitempty"`
+	Images          []KustomizeImage           `yaml:"images,omitempty"`
+	Replicas        []KustomizeReplica         `yaml:"replicas,omitempty"`
+	Patches         []KustomizePatch           `yaml:"patches,omitempty"`
+	SecretGenerator []KustomizeSecretGenerator `yaml:"secretGenerator,omitempty"`
+}
+
+// kustomizeOverlay holds what differs between environments.
+type kustomizeOverlay struct {
+	Registry    string
+	Replicas    int
+	MinReplicas int
+	MaxReplicas int
+	Resources   K8sResources
+}
+
+func getKustomizeOverlays(tier string) map[string]kustomizeOverlay {
+	localMinReplicas, localMaxReplicas := getK8sLocalHPAReplicas(tier)
+	return map[string]kustomizeOverlay{
+		k8sEnvLocal: {
+			Registry:    GlobalConfig.LocalRegistry,
+			Replicas:    1,
+			MinReplicas: localMinReplicas,
+			MaxReplicas: localMaxReplicas,
+			Resources: K8sResources{
+				Requests: K8sResourceRequirements{Memory: "64Mi", CPU: "100m"},
+				Limits:   K8sResourceRequirements{Memory: "256Mi", CPU: "500m"},
+			},
+		},
+		k8sEnvRemote: {
+			Registry:    GlobalConfig.RemoteRegistry,
+			Replicas:    getK8sTierPolicy(tier).Replicas,
+			MinReplicas: getK8sTierPolicy(tier).MinReplicas,
+			MaxReplicas: getK8sTierPolicy(tier).MaxReplicas,
+			Resources: K8sResources{
+				Requests: K8sResourceRequirements{Memory: "256Mi", CPU: "500m"},
+				Limits:   K8sResourceRequirements{Memory: "1Gi", CPU: "1"},
+			},
+		},
+	}
+}
+
+const kustomizeResourcesPatchTemplate = `apiVersion: {{ .APIVersion }}
+kind: {{ .Kind }}
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+spec:
+  template:
+    spec:
+      containers:
+      - name: {{ .AppName }}
+        resources:
+          requests:
+            memory: "{{ .Resources.Requests.Memory }}"
+            cpu: "{{ .Resources.Requests.CPU }}"
+          limits:
+            memory: "{{ .Resources.Limits.Memory }}"
+            cpu: "{{ .Resources.Limits.CPU }}"
+`
+
+const kustomizeHPAPatchTemplate = `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: {{ .AppName }}-hpa
+  namespace: {{ .Namespace }}
+spec:
+  minReplicas: {{ .MinReplicas }}
+  maxReplicas: {{ .MaxReplicas }}
+`
+
+type kustomizeResourcesPatchData struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+	AppName    string
+	Resources  K8sResources
+}
+
+func getKustomizeOverlayFolder(env string) string {
+	return filepath.Join(k8sManifestFolder, kustomizeOverlayFolder, env)
+}
+
+func loadKustomization(path string, namespace string) (*Kustomization, error) {
+	kustomization := &Kustomization{
+		APIVersion: kustomizationAPIVersion,
+		Kind:       kustomizationKind,
+		Namespace:  namespace,
+	}
+	if err := readYamlFile(path, kustomization); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return kustomization, nil
+}
+
+func appendUnique[T comparable](list []T, item T) []T {
+	if slices.Contains(list, item) {
+		return list
+	}
+
+	return append(list, item)
+}
+
+// upsertByName replaces the item with the same name, or appends it.
+func upsertByName[T any](list []T, item T, name func(T) string) []T {
+	for i := range list {
+		if name(list[i]) == name(item) {
+			list[i] = item
+			return list
+		}
+	}
+
+	return append(list, item)
+}
+
+func writeKustomizeBase(kind string, tier string, policies []string, metric *K8sHPAMetric, namespace string, appName string) error {
+	baseFolder := filepath.Join(k8sManifestFolder, kustomizeBaseFolder, appName)
+	if err := os.MkdirAll(baseFolder, 0755); err != nil {
+		return err
+	}
+
+	// The image name is left without registry, overlays point it at their registry.
+	image := namespace + "/" + appName
+	resources := make([]string, 0, 3)
+	switch kind {
+	case K8sManifestKindDeployment:
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sDeploymentFile), k8sDeploymentTemplate, K8sDeploymentData{
+			AppName:       appName,
+			Namespace:     namespace,
+			Tier:          tier,
+			Version:       "v1.0.0",
+			ChangeCause:   "Initial deployment",
+			ContainerName: appName,
+			Image:         image,
+			Tag:           "latest",
+			Port:          8080,
+			Replicas:      1,
+			Health:        newK8sHealth(),
+		}); err != nil {
+			return err
+		}
+
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sServiceFile), K8sServiceTemplate, K8sServiceData{
+			AppName:     appName,
+			Namespace:   namespace,
+			Description: "Write description here",
+			ServicePort: 80,
+			TargetPort:  8080,
+			ServiceType: "ClusterIP",
+		}); err != nil {
+			return err
+		}
+
+		resources = append(resources, k8sDeploymentFile, k8sServiceFile)
+	case K8sManifestKindCronJob:
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sCronJobFile), K8sCronJobTemplate, CronJobData{
+			CronJobName:       appName,
+			Namespace:         namespace,
+			JobType:           "cron",
+			Description:       "Write description here",
+			Schedule:          "*/5 * * * *",
+			ContainerName:     appName + "-cronjob",
+			Image:             image,
+			Tag:               "latest",
+			RestartPolicy:     "OnFailure",
+			ConcurrencyPolicy: "Forbid",
+		}); err != nil {
+			return err
+		}
+
+		resources = append(resources, k8sCronJobFile)
+	case K8sManifestKindStatefulSet:
+		data := newK8sStatefulSetData(tier, namespace, appName, nil)
+		data.Image = image
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sStatefulSetFile), k8sStatefulSetTemplate, data); err != nil {
+			return err
+		}
+
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sServiceFile), k8sHeadlessServiceTemplate, newK8sHeadlessServiceData(namespace, appName)); err != nil {
+			return err
+		}
+
+		resources = append(resources, k8sStatefulSetFile, k8sServiceFile)
+	case K8sManifestKindJob:
+		data := newK8sJobData(tier, namespace, appName, nil)
+		data.Image = image
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sJobFile), k8sJobTemplate, data); err != nil {
+			return err
+		}
+
+		resources = append(resources, k8sJobFile)
+	case K8sManifestKindDaemonSet:
+		data := newK8sDaemonSetData(tier, namespace, appName, nil)
+		data.Image = image
+		if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sDaemonSetFile), k8sDaemonSetTemplate, data); err != nil {
+			return err
+		}
+
+		resources = append(resources, k8sDaemonSetFile)
+	default:
+		return fmt.Errorf("unknown manifest kind: %s", kind)
+	}
+
+	if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sConfigMapFile), k8sConfigMapTemplate, K8sConfigMapData{
+		Name:      appName,
+		Namespace: namespace,
+		Labels:    map[string]string{"app": appName},
+		Data:      map[string]string{"key": "value", "loopback": "127.0.0.1"},
+	}); err != nil {
+		return err
+	}
+
+	// The Secret differs between environments, so the overlays provide it.
+	resources = append(resources, k8sConfigMapFile)
+
+	// Policies are written with the values of the remote cluster, the overlays patch the replica
+	// bounds of the HorizontalPodAutoscaler.
+	for _, policy := range policies {
+		switch policy {
+		case K8sPolicyHPA:
+			data, err := newK8sHPAData(kind, tier, metric, namespace, appName)
+			if err != nil {
+				return err
+			}
+
+			if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sHpaFile), k8sHpaTemplate, data); err != nil {
+				return err
+			}
+
+			resources = append(resources, k8sHpaFile)
+		case K8sPolicyPDB:
+			if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sPdbFile), k8sPdbTemplate, newK8sPDBData(namespace, appName)); err != nil {
+				return err
+			}
+
+			resources = append(resources, k8sPdbFile)
+		case K8sPolicyNetworkPolicy:
+			if err := template.WriteTemplate2File(filepath.Join(baseFolder, k8sNetworkPolicyFile), k8sNetworkPolicyTemplate, newK8sNetworkPolicyData(tier, namespace, appName)); err != nil {
+				return err
+			}
+
+			resources = append(resources, k8sNetworkPolicyFile)
+		}
+	}
+
+	return writeYamlFile(filepath.Join(baseFolder, kustomizationFileName), &Kustomization{
+		APIVersion: kustomizationAPIVersion,
+		Kind:       kustomizationKind,
+		Resources:  resources,
+	})
+}
+
+func addKustomizeOverlay(env string, overlay kustomizeOverlay, kind string, autoscaled bool, namespace string, appName string) error {
+	overlayFolder := getKustomizeOverlayFolder(env)
+	path := filepath.Join(overlayFolder, kustomizationFileName)
+	kustomization, err := loadKustomization(path, namespace)
+	if err != nil {
+		return err
+	}
+
+	kustomization.Resources = appendUnique(kustomization.Resources, filepath.ToSlash(filepath.Join("..", "..", kustomizeBaseFolder, appName)))
+
+	// Keep the tag of an earlier build, SetKustomizeOverlayBuild moves it on every build.
+	image := KustomizeImage{
+		Name:    namespace + "/" + appName,
+		NewName: overlay.Registry + "/" + namespace + "/" + appName,
+		NewTag:  "latest",
+	}
+	if i := slices.IndexFunc(kustomization.Images, func(i KustomizeImage) bool { return i.Name == image.Name }); i >= 0 && kustomization.Images[i].NewTag != "" {
+		image.NewTag = kustomization.Images[i].NewTag
+	}
+	kustomization.Images = upsertByName(kustomization.Images, image, func(i KustomizeImage) string { return i.Name })
+
+	if workload, ok := k8sWorkloads[kind]; ok {
+		if err := os.MkdirAll(filepath.Join(overlayFolder, kustomizePatchFolder), 0755); err != nil {
+			return err
+		}
+
+		// The HorizontalPodAutoscaler owns the replicas of autoscaled workloads.
+		switch {
+		case autoscaled:
+			kustomization.Replicas = slices.DeleteFunc(kustomization.Replicas, func(r KustomizeReplica) bool { return r.Name == appName+workload.suffix })
+
+			patch := filepath.ToSlash(filepath.Join(kustomizePatchFolder, appName+"-hpa.yaml"))
+			if err := template.WriteTemplate2File(filepath.Join(overlayFolder, patch), kustomizeHPAPatchTemplate, K8sHPAData{
+				AppName:     appName,
+				Namespace:   namespace,
+				MinReplicas: overlay.MinReplicas,
+				MaxReplicas: overlay.MaxReplicas,
+			}); err != nil {
+				return err
+			}
+
+			kustomization.Patches = upsertByName(kustomization.Patches, KustomizePatch{Path: patch}, func(p KustomizePatch) string { return p.Path })
+		case workload.replicas:
+			kustomization.Replicas = upsertByName(kustomization.Replicas, KustomizeReplica{
+				Name:  appName + workload.suffix,
+				Count: overlay.Replicas,
+			}, func(r KustomizeReplica) string { return r.Name })
+		}
+
+		patch := filepath.ToSlash(filepath.Join(kustomizePatchFolder, appName+"-resources.yaml"))
+
+		if err := template.WriteTemplate2File(filepath.Join(overlayFolder, patch), kustomizeResourcesPatchTemplate, kustomizeResourcesPatchData{
+			APIVersion: workload.apiVersion,
+			Kind:       workload.kind,
+			Name:       appName + workload.suffix,
+			Namespace:  namespace,
+			AppName:    appName,
+			Resources:  overlay.Resources,
+		}); err != nil {
+			return err
+		}
+
+		kustomization.Patches = upsertByName(kustomization.Patches, KustomizePatch{Path: patch}, func(p KustomizePatch) string { return p.Path })
+	}
+
+	if err := addKustomizeOverlaySecret(env, kustomization, namespace, appName); err != nil {
+		return err
+	}
+
+	return writeYamlFile(path, kustomization)
+}
+
+// SetKustomizeOverlayBuild points the image of the cmd in the local overlay at the built version,
+// as SetK8sDeploymentBuild does for the raw manifest. It reports false when the overlay has no
+// image of the cmd.
+func SetKustomizeOverlayBuild(version string, cmdDepth ...string) (bool, error) {
+	path := filepath.Join(getKustomizeOverlayFolder(k8sEnvLocal), kustomizationFileName)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	kustomization, err := loadKustomization(path, GlobalConfig.Namespace)
+	if err != nil {
+		return false, err
+	}
+
+	name := GlobalConfig.Namespace + "/" + MakeCmdDepthToName(cmdDepth...)
+	i := slices.IndexFunc(kustomization.Images, func(i KustomizeImage) bool { return i.Name == name })
+	if i < 0 {
+		return false, nil
+	}
+
+	kustomization.Images[i].NewTag = version
+	if err := writeYamlFile(path, kustomization); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// addKustomizeOverlaySecret adds the app's Secret to the overlay: generated from development values
+// for the local cluster, and an ExternalSecret syncing it from the secret store for the remote one.
+// Values edited in the overlay are kept.
+func addKustomizeOverlaySecret(env string, kustomization *Kustomization, namespace string, appName string) error {
+	local, remote := newK8sSecretData(namespace, appName)
+	if env == k8sEnvLocal {
+		if slices.ContainsFunc(kustomization.SecretGenerator, func(g KustomizeSecretGenerator) bool { return g.Name == local.Name+"-secret" }) {
+			return nil
+		}
+
+		generator := KustomizeSecretGenerator{Name: local.Name + "-secret"}
+		for _, key := range slices.Sorted(maps.Keys(local.Data)) {
+			generator.Literals = append(generator.Literals, key+"="+local.Data[key])
+		}
+		kustomization.SecretGenerator = append(kustomization.SecretGenerator, generator)
+
+		return nil
+	}
+
+	secret := filepath.ToSlash(filepath.Join(kustomizeSecretFolder, appName+"-"+k8sExternalSecretFile))
+	kustomization.Resources = appendUnique(kustomization.Resources, secret)
+
+	path := filepath.Join(getKustomizeOverlayFolder(env), secret)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return template.WriteTemplate2File(path, k8sExternalSecretTemplate, remote)
+}
+
+// GenerateKustomizeManifests writes the cmd's manifests to manifests/base/<app> and adds the app
+// to the local and remote overlays, which set the image registry, replica count and resources.
+// Selected policies are written to the base, and the overlays patch the replica bounds of the
+// HorizontalPodAutoscaler instead of the replica count.
+func GenerateKustomizeManifests(kind string, tier string, policies []string, metric *K8sHPAMetric, namespace string, cmdDepth ...string) error {
+	appName := MakeCmdDepthToName(cmdDepth...)
+	if err := writeKustomizeBase(kind, tier, policies, metric, namespace, appName); err != nil {
+		return err
+	}
+
+	autoscaled := slices.Contains(policies, K8sPolicyHPA)
+	for env, overlay := range getKustomizeOverlays(tier) {
+		if err := addKustomizeOverlay(env, overlay, kind, autoscaled, namespace, appName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func SelectKustomizeOverlay() (string, error) {
+	entries, err := os.ReadDir(filepath.Join(k8sManifestFolder, kustomizeOverlayFolder))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no kustomize overlays found, run 'ako k3d manifest create --kustomize' first")
+		}
+		return "", err
+	}
+
+	overlays := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			overlays = append(overlays, entry.Name())
+		}
+	}
+
+	if len(overlays) == 0 {
+		return "", fmt.Errorf("no kustomize overlays found")
+	}
+
+	selected := overlays[0]
+	if slices.Contains(overlays, k8sEnvLocal) {
+		selected = k8sEnvLocal
+	}
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select the overlay to apply:",
+		Options: overlays,
+		Default: selected,
+	}, &selected, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	return selected, nil
+}
+
+// PlanKustomizeOverlay builds the overlay in-process, as 'kubectl apply -k' would, and plans the
+// apply of the resources it renders like that of manifest files.
+func PlanKustomizeOverlay(ctx context.Context, env string) (*K8sApplyPlan, error) {
+	folder := getKustomizeOverlayFolder(env)
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), folder)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &K8sApplyPlan{}
+	for _, resource := range resources.Resources() {
+		object, err := resource.Map()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", folder, resource.CurId(), err)
+		}
+
+		plan.Changes = append(plan.Changes, K8sApplyChange{
+			File:      folder,
+			Kind:      resource.GetKind(),
+			Name:      resource.GetName(),
+			Namespace: resource.GetNamespace(),
+			object:    &unstructured.Unstructured{Object: object},
+		})
+	}
+
+	return planK8sChanges(ctx, plan)
+}
@@ -27,6 +27,15 @@ func RunGolangcilint() error {
 	return nil
 }
 
+func RunGolangcilintOnPackages(packages ...string) error {
+	args := append([]string{"run"}, packages...)
+	if err := module.RunGoModuleTool(golangcilintToolName, args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func CreateGolangcilintConfig() error {
 	if err := template.WriteTemplate2File(golangcilintFileName, golangcilintConfig, map[string]any{}); err != nil {
 		return err
@@ -0,0 +1,107 @@
+package packages
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/gosuda/ako/util/module"
+	"github.com/gosuda/ako/util/table"
+)
+
+const rootPackageInternal = "internal"
+
+// archForbiddenImports lists, per layer, the layers it must not import to keep dependencies unidirectional.
+var archForbiddenImports = map[string][]string{
+	RootPackageLib:                {RootPackagePkg, rootPackageInternal, RootPackageCmd},
+	RootPackagePkg:                {rootPackageInternal, RootPackageCmd},
+	RootPackageInternalService:    {RootPackageInternalController, RootPackagePkg, RootPackageCmd},
+	RootPackageInternalController: {RootPackagePkg, RootPackageCmd},
+	rootPackageInternal:           {RootPackagePkg, RootPackageCmd},
+}
+
+type ArchViolation struct {
+	Package string
+	Layer   string
+	Import  string
+}
+
+func isInLayer(path string, layer string) bool {
+	return path == layer || strings.HasPrefix(path, layer+"/")
+}
+
+func getArchLayer(path string) string {
+	for _, layer := range []string{RootPackageInternalController, RootPackageInternalService, rootPackageInternal, RootPackageLib, RootPackagePkg, RootPackageCmd} {
+		if isInLayer(path, layer) {
+			return layer
+		}
+	}
+
+	return ""
+}
+
+func CheckArchitecture(patterns ...string) ([]ArchViolation, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	moduleName, err := module.GetGoModuleName()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"list", "-f", `{{.ImportPath}}{{range .Imports}} {{.}}{{end}}`}, patterns...)
+	output, err := exec.Command("go", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	violations := make([]ArchViolation, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		pkg := strings.TrimPrefix(fields[0], moduleName+"/")
+		layer := getArchLayer(pkg)
+		forbidden, ok := archForbiddenImports[layer]
+		if !ok {
+			continue
+		}
+
+		for _, imported := range fields[1:] {
+			if !strings.HasPrefix(imported, moduleName+"/") {
+				continue
+			}
+
+			imported = strings.TrimPrefix(imported, moduleName+"/")
+			for _, f := range forbidden {
+				if isInLayer(imported, f) {
+					violations = append(violations, ArchViolation{
+						Package: pkg,
+						Layer:   layer,
+						Import:  imported,
+					})
+					break
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return violations, nil
+}
+
+func PrintArchViolations(violations []ArchViolation) {
+	tbl := table.NewTableBuilder("PACKAGE", "LAYER", "FORBIDDEN IMPORT")
+	for _, violation := range violations {
+		tbl.AppendRow(violation.Package, violation.Layer, violation.Import)
+	}
+	tbl.Print()
+}
@@ -182,6 +182,8 @@ import (
 	"time"
 
 	"go.uber.org/fx"
+
+	"{{.module_name}}/{{.health_package}}"
 )
 
 func newStartupContext() context.Context {
@@ -192,9 +194,12 @@ func main() {
 	app := fx.New(fx.Provide(newStartupContext),
 		fx.StartTimeout(15*time.Second),
 		fx.StopTimeout(15*time.Second),
+		health.Module,
 		fx.Invoke(func() {
 			fmt.Println("Hello, world!")
 		}),
+		// Keep it last, the cmd is ready once every module above has started.
+		fx.Invoke(health.MarkReady),
 	)
 	app.Run()
 
@@ -209,17 +214,19 @@ func CreateFxExecutableFile(path string) error {
 		return err
 	}
 
-	file, err := os.Create(filepath.Join(path, fxExecutableFileName))
+	moduleName, err := module.GetGoModuleName()
 	if err != nil {
-		return err
+		return fmt.Errorf("getGoModuleName: %w", err)
 	}
-	defer file.Close()
 
-	if _, err := file.WriteString(fxExecutableFileTemplate); err != nil {
+	if err := CreateFxHealthPackage(); err != nil {
 		return err
 	}
 
-	if err := file.Sync(); err != nil {
+	if err := template.WriteTemplate2File(filepath.Join(path, fxExecutableFileName), fxExecutableFileTemplate, map[string]any{
+		"module_name":    moduleName,
+		"health_package": healthPackagePath,
+	}); err != nil {
 		return err
 	}
 
@@ -0,0 +1,170 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gosuda/ako/util/module"
+	"github.com/gosuda/ako/util/template"
+)
+
+// The health module of generated cmds and the probes of generated manifests both use these, so
+// they stay in sync.
+const (
+	HealthPort          = 8081
+	HealthLivenessPath  = "/healthz"
+	HealthReadinessPath = "/readyz"
+	HealthMetricsPath   = "/metrics"
+)
+
+const (
+	healthPackagePath          = RootPackagePkg + "/health"
+	healthDependencyPrometheus = `github.com/prometheus/client_golang`
+	healthPackageName          = "health"
+	healthServerName           = "Health"
+	healthServerTemplate       = `package {{.package_name}}
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/fx"
+)
+
+const Name = "{{.server_name}}"
+
+// Module serves the liveness, readiness and metrics endpoints on their own port, so they stay
+// reachable whatever the cmd serves. Invoke MarkReady last to report the cmd as ready.
+var Module = fx.Module("{{.package_name}}",
+	fx.Provide(New, ConfigRegister()),
+	fx.Invoke(func(svr *{{.server_name}}) {}),
+)
+
+func ConfigRegister() func() *Config {
+	return func() *Config {
+		addr := os.Getenv("HEALTH_ADDR")
+		if addr == "" {
+			addr = ":{{.port}}"
+		}
+
+		return &Config{
+			Addr: addr,
+		}
+	}
+}
+
+type Param struct {
+	fx.In
+	Cfg *Config
+}
+
+type {{.server_name}} struct {
+	ready atomic.Bool
+	svr   *http.Server
+}
+
+type Config struct {
+	Addr string
+}
+
+func New(ctx context.Context, lc fx.Lifecycle, param Param) *{{.server_name}} {
+	svr := &{{.server_name}}{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET {{.liveness_path}}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("GET {{.readiness_path}}", func(w http.ResponseWriter, r *http.Request) {
+		if !svr.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("GET {{.metrics_path}}", promhttp.Handler())
+
+	svr.svr = &http.Server{
+		Addr:              param.Cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			lis, err := net.Listen("tcp", param.Cfg.Addr)
+			if err != nil {
+				return fmt.Errorf("net.Listen: %w", err)
+			}
+
+			go func() {
+				if err := svr.svr.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Printf("failed to serve health: %v", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return svr.svr.Shutdown(ctx)
+		},
+	})
+
+	return svr
+}
+
+func (svr *{{.server_name}}) SetReady(ready bool) {
+	svr.ready.Store(ready)
+}
+
+// MarkReady reports the cmd as ready once every module invoked before it has started, and as not
+// ready as soon as it starts stopping, so no new traffic is routed to it while shutting down.
+func MarkReady(lc fx.Lifecycle, svr *{{.server_name}}) {
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			svr.SetReady(true)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			svr.SetReady(false)
+			return nil
+		},
+	})
+}`
+)
+
+// CreateFxHealthPackage writes the health module shared by the cmds, unless it already exists.
+func CreateFxHealthPackage() error {
+	fileName := filepath.Join(healthPackagePath, fmt.Sprintf(fxFileName, healthServerName))
+	if _, err := os.Stat(fileName); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(healthPackagePath, os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := template.WriteTemplate2File(fileName, healthServerTemplate, map[string]any{
+		"package_name":   healthPackageName,
+		"server_name":    healthServerName,
+		"port":           HealthPort,
+		"liveness_path":  HealthLivenessPath,
+		"readiness_path": HealthReadinessPath,
+		"metrics_path":   HealthMetricsPath,
+	}); err != nil {
+		return err
+	}
+
+	if err := module.GetGoModule(healthDependencyPrometheus); err != nil {
+		return fmt.Errorf("getGoModule: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+var changelogSections = []struct {
+	Title string
+	Types []string
+}{
+	{Title: "Features", Types: []string{"feat"}},
+	{Title: "Fixes", Types: []string{"fix"}},
+	{Title: "Performance", Types: []string{"perf"}},
+	{Title: "Refactoring", Types: []string{"refactor"}},
+	{Title: "Others", Types: []string{"init", "build", "chore", "ci", "docs", "style", "test"}},
+}
+
+// GenerateChangelog groups the Conventional Commits of revRange by type.
+// Commits that do not follow the convention, such as merge commits, are left out.
+func GenerateChangelog(revRange string) (string, error) {
+	commits, err := listCommitMessages(revRange)
+	if err != nil {
+		return "", err
+	}
+
+	breaking := make([]string, 0)
+	grouped := make(map[string][]string)
+	for _, commit := range commits {
+		message := strings.TrimSpace(commit[1])
+		subject, _, _ := strings.Cut(message, "\n")
+		matches := conventionalCommitRegex.FindStringSubmatch(strings.TrimSpace(subject))
+		if matches == nil {
+			continue
+		}
+
+		commitType, scope, description := matches[1], matches[3], matches[5]
+		entry := description
+		if scope != "" {
+			entry = fmt.Sprintf("%s: %s", scope, description)
+		}
+
+		if matches[4] == "!" || hasBreakingChangeFooter(message) {
+			breaking = append(breaking, entry)
+		}
+
+		grouped[commitType] = append(grouped[commitType], entry)
+	}
+
+	builder := strings.Builder{}
+	writeSection := func(title string, entries []string) {
+		if len(entries) == 0 {
+			return
+		}
+
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+
+		builder.WriteString(title)
+		builder.WriteString(":\n")
+		for _, entry := range entries {
+			builder.WriteString("- ")
+			builder.WriteString(entry)
+			builder.WriteString("\n")
+		}
+	}
+
+	writeSection("Breaking Changes", breaking)
+	for _, section := range changelogSections {
+		entries := make([]string, 0)
+		for _, t := range section.Types {
+			entries = append(entries, grouped[t]...)
+		}
+		writeSection(section.Title, entries)
+	}
+
+	return builder.String(), nil
+}
@@ -0,0 +1,228 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+const (
+	CommitLintLevelError   = "error"
+	CommitLintLevelWarning = "warning"
+)
+
+// Rule names follow commitlint so that results are familiar to CI users.
+const (
+	commitLintRuleHeaderFormat      = "header-format"
+	commitLintRuleTypeEnum          = "type-enum"
+	commitLintRuleSubjectEmpty      = "subject-empty"
+	commitLintRuleSubjectCase       = "subject-case"
+	commitLintRuleSubjectFullStop   = "subject-full-stop"
+	commitLintRuleSubjectImperative = "subject-imperative"
+	commitLintRuleBranchType        = "branch-type"
+	commitLintRuleBreakingChange    = "breaking-change"
+)
+
+// nonImperativeExceptions are verbs in imperative form that still end like past tense or a gerund.
+var nonImperativeExceptions = []string{
+	"embed", "need", "feed", "seed", "speed", "shed", "proceed", "succeed", "exceed", "red", "bed",
+	"bring", "ping", "ring", "sing", "sling", "spring", "sting", "string", "swing", "wring", "cling", "fling", "wing", "ding",
+}
+
+type CommitLintIssue struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+type CommitLintResult struct {
+	Hash    string            `json:"hash"`
+	Subject string            `json:"subject"`
+	Valid   bool              `json:"valid"`
+	Issues  []CommitLintIssue `json:"issues"`
+}
+
+func newCommitLintError(rule string, format string, args ...any) CommitLintIssue {
+	return CommitLintIssue{Rule: rule, Level: CommitLintLevelError, Message: fmt.Sprintf(format, args...)}
+}
+
+func newCommitLintWarning(rule string, format string, args ...any) CommitLintIssue {
+	return CommitLintIssue{Rule: rule, Level: CommitLintLevelWarning, Message: fmt.Sprintf(format, args...)}
+}
+
+func isImperative(word string) bool {
+	word = strings.ToLower(word)
+	if slices.Contains(nonImperativeExceptions, word) {
+		return true
+	}
+
+	return !(len(word) > 4 && (strings.HasSuffix(word, "ed") || strings.HasSuffix(word, "ing")))
+}
+
+func hasBreakingChangeFooter(message string) bool {
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lintCommitBranchHint(commitType string, breaking bool, branchName string) []CommitLintIssue {
+	issues := make([]CommitLintIssue, 0)
+	prefix, _, _ := deconstructSubBranchName(branchName)
+	switch prefix {
+	case gitBranchPrefixFeature:
+		if commitType != "feat" {
+			issues = append(issues, newCommitLintWarning(commitLintRuleBranchType, "'feat' is expected on %s/* branches, got '%s'", prefix, commitType))
+		}
+	case gitBranchPrefixPatch, gitBranchPrefixHotfix:
+		if commitType != "fix" {
+			issues = append(issues, newCommitLintWarning(commitLintRuleBranchType, "'fix' is expected on %s/* branches, got '%s'", prefix, commitType))
+		}
+	}
+
+	switch prefix {
+	case gitBranchPrefixFeature, gitBranchPrefixPatch, gitBranchPrefixHotfix:
+		if breaking {
+			issues = append(issues, newCommitLintWarning(commitLintRuleBreakingChange, "breaking change on a backward-compatible %s/* branch, use a break/* branch instead", prefix))
+		}
+	}
+
+	return issues
+}
+
+// LintCommitMessage checks a commit message against the Conventional Commits rules.
+// When branchName is not empty, the branch hierarchy hints are checked as well.
+func LintCommitMessage(message string, branchName string) []CommitLintIssue {
+	message = strings.TrimSpace(message)
+	subject, _, _ := strings.Cut(message, "\n")
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return []CommitLintIssue{newCommitLintError(commitLintRuleSubjectEmpty, "commit message is empty")}
+	}
+
+	if isGeneratedCommitMessage(subject) {
+		return nil
+	}
+
+	matches := conventionalCommitRegex.FindStringSubmatch(subject)
+	if matches == nil {
+		return []CommitLintIssue{newCommitLintError(commitLintRuleHeaderFormat, "commit message does not match '<type>[optional scope][!]: <description>': %s", subject)}
+	}
+
+	commitType, breaking, description := matches[1], matches[4] == "!", strings.TrimSpace(matches[5])
+	issues := make([]CommitLintIssue, 0)
+	if !slices.Contains(conventionalCommitTypes, commitType) {
+		issues = append(issues, newCommitLintError(commitLintRuleTypeEnum, "invalid commit type: %s (allowed: %s)", commitType, strings.Join(conventionalCommitTypes, ", ")))
+	}
+
+	if description == "" {
+		issues = append(issues, newCommitLintError(commitLintRuleSubjectEmpty, "commit description is empty"))
+		return issues
+	}
+
+	if first := []rune(description)[0]; unicode.IsUpper(first) {
+		issues = append(issues, newCommitLintError(commitLintRuleSubjectCase, "commit description must begin with a lowercase letter: %s", description))
+	}
+
+	if strings.HasSuffix(description, ".") {
+		issues = append(issues, newCommitLintError(commitLintRuleSubjectFullStop, "commit description must not end with a period: %s", description))
+	}
+
+	if word := strings.Fields(description)[0]; !isImperative(word) {
+		issues = append(issues, newCommitLintWarning(commitLintRuleSubjectImperative, "use the imperative, present tense: %s", word))
+	}
+
+	if branchName != "" {
+		issues = append(issues, lintCommitBranchHint(commitType, breaking || hasBreakingChangeFooter(message), branchName)...)
+	}
+
+	return issues
+}
+
+func listCommitMessages(revRange string) ([][2]string, error) {
+	args := []string{"log", "--format=%H%x00%B%x1e"}
+	if revRange == "" {
+		args = append(args, "-1", "HEAD")
+	} else {
+		args = append(args, revRange)
+	}
+
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([][2]string, 0)
+	for _, record := range bytes.Split(output, []byte{0x1e}) {
+		record = bytes.TrimSpace(record)
+		if len(record) == 0 {
+			continue
+		}
+
+		hash, body, ok := bytes.Cut(record, []byte{0})
+		if !ok {
+			return nil, fmt.Errorf("unexpected log output: %s", record)
+		}
+
+		commits = append(commits, [2]string{string(hash), string(body)})
+	}
+
+	return commits, nil
+}
+
+// LintCommitRange lints every commit of revRange (e.g. "develop..HEAD"). An empty range lints HEAD only.
+func LintCommitRange(revRange string, branchName string) ([]CommitLintResult, error) {
+	commits, err := listCommitMessages(revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CommitLintResult, 0, len(commits))
+	for _, commit := range commits {
+		subject, _, _ := strings.Cut(strings.TrimSpace(commit[1]), "\n")
+		issues := LintCommitMessage(commit[1], branchName)
+		if issues == nil {
+			issues = []CommitLintIssue{}
+		}
+
+		valid := true
+		for _, issue := range issues {
+			if issue.Level == CommitLintLevelError {
+				valid = false
+				break
+			}
+		}
+
+		results = append(results, CommitLintResult{
+			Hash:    commit[0],
+			Subject: subject,
+			Valid:   valid,
+			Issues:  issues,
+		})
+	}
+
+	return results, nil
+}
+
+func PrintCommitLintResults(results []CommitLintResult) {
+	tbl := table.NewTableBuilder("COMMIT", "LEVEL", "RULE", "MESSAGE")
+	for _, result := range results {
+		if len(result.Issues) == 0 {
+			tbl.AppendRow(result.Hash[:7], "ok", "", result.Subject)
+			continue
+		}
+
+		for _, issue := range result.Issues {
+			tbl.AppendRow(result.Hash[:7], issue.Level, issue.Rule, issue.Message)
+		}
+	}
+	tbl.Print()
+}
@@ -0,0 +1,20 @@
+package git
+
+import "testing"
+
+func TestIsImperative(t *testing.T) {
+	for word, want := range map[string]bool{
+		"add":     true,
+		"Bring":   true,
+		"ping":    true,
+		"string":  true,
+		"embed":   true,
+		"adding":  false,
+		"fixed":   false,
+		"Updated": false,
+	} {
+		if got := isImperative(word); got != want {
+			t.Errorf("isImperative(%q) = %v, want %v", word, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -44,7 +45,7 @@ func GetGitBranchName() (string, error) {
 
 func getGitBranchesWithPrefixSuffix(prefix, suffix string) ([]string, error) {
 	query := fmt.Sprintf("%s*%s", prefix, suffix)
-	cmd := exec.Command("git", "branch", "--list", query)
+	cmd := exec.Command("git", "branch", "--list", "--format=%(refname:short)", query)
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, err
@@ -117,6 +118,8 @@ func getGitSubBranchPrefix(prefix string) (string, error) {
 		return subPrefix, nil
 	case gitBranchPrefixFeature, gitBranchPrefixPatch, gitBranchPrefixBreak:
 		return gitBranchPrefixProposal, nil
+	case gitBranchPrefixHotfix:
+		return "", fmt.Errorf("hotfix branch cannot create sub branch")
 	}
 
 	return "", fmt.Errorf("invalid prefix: %s", prefix)
@@ -135,6 +138,15 @@ func MakeGitSubBranchName(branchName string) (string, error) {
 
 	switch prefix {
 	case GitBranchPrefixRelease:
+		if subPrefix == gitBranchPrefixHotfix {
+			hotfixName, err := InputHotfixName()
+			if err != nil {
+				return "", err
+			}
+
+			return constructSubBranchName(subPrefix, "", hotfixName)
+		}
+
 		return constructSubBranchName(subPrefix, "", "")
 	case gitBranchPrefixStaging:
 		return constructSubBranchName(subPrefix, "", "")
@@ -194,18 +206,34 @@ func SwitchOrCreateGitBranchTo(branchName string) error {
 	return nil
 }
 
+// CreateGitBranchTo creates the branch from HEAD and switches to it, failing when it already exists.
+func CreateGitBranchTo(branchName string) error {
+	cmd := exec.Command("git", "switch", "-c", branchName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func GetParentBranchName() ([]string, error) {
 	current, err := GetGitBranchName()
 	if err != nil {
 		return nil, err
 	}
 
-	currentPrefix, superName, _ := deconstructSubBranchName(current)
+	return getParentBranchNameOf(current)
+}
+
+func getParentBranchNameOf(branchName string) ([]string, error) {
+	currentPrefix, superName, _ := deconstructSubBranchName(branchName)
 	parentPrefix := make([]string, 0)
 	switch currentPrefix {
 	case GitBranchPrefixRelease:
 		return nil, fmt.Errorf("release branch cannot have parent branch")
-	case gitBranchPrefixStaging:
+	case gitBranchPrefixStaging, gitBranchPrefixHotfix:
 		parentPrefix = []string{GitBranchPrefixRelease}
 	case gitBranchPrefixDevelop:
 		parentPrefix = []string{gitBranchPrefixStaging}
@@ -238,11 +266,15 @@ func GetChildrenBranchName() ([]string, error) {
 		return nil, err
 	}
 
-	currentPrefix, _, name := deconstructSubBranchName(current)
+	return getChildrenBranchNameOf(current)
+}
+
+func getChildrenBranchNameOf(branchName string) ([]string, error) {
+	currentPrefix, _, name := deconstructSubBranchName(branchName)
 	childrenPrefix := make([]string, 0)
 	switch currentPrefix {
 	case GitBranchPrefixRelease:
-		childrenPrefix = []string{gitBranchPrefixStaging}
+		childrenPrefix = []string{gitBranchPrefixStaging, gitBranchPrefixHotfix}
 	case gitBranchPrefixStaging:
 		childrenPrefix = []string{gitBranchPrefixDevelop}
 	case gitBranchPrefixDevelop:
@@ -253,13 +285,21 @@ func GetChildrenBranchName() ([]string, error) {
 		childrenPrefix = []string{gitBranchPrefixProposal}
 	case gitBranchPrefixProposal:
 		return nil, fmt.Errorf("proposal branch cannot have children branch")
+	case gitBranchPrefixHotfix:
+		return nil, fmt.Errorf("hotfix branch cannot have children branch")
 	default:
 		return nil, fmt.Errorf("invalid prefix: %s", currentPrefix)
 	}
 
 	branches := make([]string, 0)
 	for _, prefix := range childrenPrefix {
-		b, err := getGitBranchesWithPrefixSuffix(prefix+"/"+name, "")
+		query := prefix
+		if name != "" {
+			// The trailing slash stops the match at the path boundary, so epic/api does not take in feature/api-v2/*.
+			query = prefix + "/" + name + "/"
+		}
+
+		b, err := getGitBranchesWithPrefixSuffix(query, "")
 		if err != nil {
 			return nil, err
 		}
@@ -316,6 +356,138 @@ func pushGitFiles() error {
 	return nil
 }
 
+func MergeGitBranch(branchName string) error {
+	cmd := exec.Command("git", "merge", "--no-ff", "--no-edit", branchName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func RebaseGitBranch(upstream string) error {
+	cmd := exec.Command("git", "rebase", upstream)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func isGitAncestor(ancestor string, descendant string) (bool, error) {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ancestor, descendant)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func IsGitWorkingTreeClean() (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=no")
+	output, err := cmd.Output()
+	if err != nil {
+		return false, err
+	}
+
+	return len(bytes.TrimSpace(output)) == 0, nil
+}
+
+// DescribeGitHead describes the commit HEAD is at as "<short hash> <subject>", marked as dirty when
+// the working tree has uncommitted changes, which are then part of what was built.
+func DescribeGitHead() (string, error) {
+	cmd := exec.Command("git", "log", "-1", "--format=%h %s")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	description := string(bytes.TrimSpace(output))
+	clean, err := IsGitWorkingTreeClean()
+	if err != nil {
+		return "", err
+	}
+
+	if !clean {
+		description += " (dirty)"
+	}
+
+	return description, nil
+}
+
+func getGitPath(name string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--git-path", name)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSpace(output)), nil
+}
+
+func isGitMergeInProgress() (bool, error) {
+	path, err := getGitPath("MERGE_HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func isGitRebaseInProgress() (bool, error) {
+	for _, name := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := getGitPath(name)
+		if err != nil {
+			return false, err
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			return true, nil
+		} else if !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+func abortGitMerge() error {
+	cmd := exec.Command("git", "merge", "--abort")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func abortGitRebase() error {
+	cmd := exec.Command("git", "rebase", "--abort")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func pullGitFiles() error {
 	cmd := exec.Command("git", "pull")
 	cmd.Stdout = os.Stdout
@@ -0,0 +1,181 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	GitHookCommitMsg = "commit-msg"
+	GitHookPreCommit = "pre-commit"
+	GitHookPrePush   = "pre-push"
+)
+
+var gitHookNames = []string{GitHookCommitMsg, GitHookPreCommit, GitHookPrePush}
+
+const gitHookMarker = "# managed by ako"
+
+const gitHookTemplate = `#!/bin/sh
+%s
+exec ako hooks %s "$@"
+`
+
+func getGitHooksDir() (string, error) {
+	return getGitPath("hooks")
+}
+
+func isAkoGitHook(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.Contains(string(content), gitHookMarker), nil
+}
+
+func InstallGitHooks() error {
+	dir, err := getGitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, name := range gitHookNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			managed, err := isAkoGitHook(path)
+			if err != nil {
+				return err
+			}
+
+			if !managed {
+				backup := path + ".backup"
+				if err := os.Rename(path, backup); err != nil {
+					return err
+				}
+
+				log.Printf("Existing %s hook moved to %s", name, backup)
+			}
+		}
+
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(gitHookTemplate, gitHookMarker, name)), 0755); err != nil {
+			return err
+		}
+
+		log.Printf("Installed git hook: %s", name)
+	}
+
+	return nil
+}
+
+func UninstallGitHooks() error {
+	dir, err := getGitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range gitHookNames {
+		path := filepath.Join(dir, name)
+		managed, err := isAkoGitHook(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		if !managed {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+
+		backup := path + ".backup"
+		if _, err := os.Stat(backup); err == nil {
+			if err := os.Rename(backup, path); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("Uninstalled git hook: %s", name)
+	}
+
+	return nil
+}
+
+// ExportGitIndex writes the staged content of the repository to a temporary directory, so the
+// pre-commit hook checks what is committed rather than the working tree. The caller removes it.
+func ExportGitIndex() (string, error) {
+	topLevel, err := getGitTopLevel()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp("", "ako-index-")
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("git", "checkout-index", "--all", "--prefix="+dir+string(filepath.Separator))
+	cmd.Dir = topLevel
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// ReadCommitMessageFile reads the message git passes to the commit-msg hook, without comment lines.
+func ReadCommitMessageFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// ListPushedBranches parses the "<local ref> <local sha> <remote ref> <remote sha>" lines git feeds to the pre-push hook.
+func ListPushedBranches(r io.Reader) ([]string, error) {
+	const headsPrefix = "refs/heads/"
+
+	branches := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+
+		if strings.HasPrefix(fields[0], headsPrefix) {
+			branches = append(branches, strings.TrimPrefix(fields[0], headsPrefix))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return branches, nil
+}
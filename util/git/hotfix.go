@@ -0,0 +1,141 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+func InputHotfixName() (string, error) {
+	var name string
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the hotfix name:",
+	}, &name, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid hotfix name: %s", name)
+	}
+
+	return name, nil
+}
+
+func StartHotfix(name string) (string, error) {
+	clean, err := IsGitWorkingTreeClean()
+	if err != nil {
+		return "", err
+	}
+
+	if !clean {
+		return "", fmt.Errorf("working tree has uncommitted changes")
+	}
+
+	branchName, err := constructSubBranchName(gitBranchPrefixHotfix, "", name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branchName).Run(); err == nil {
+		return "", fmt.Errorf("%s already exists, finish it or delete it first", branchName)
+	}
+
+	if err := SwitchGitBranchTo(GitBranchPrefixRelease); err != nil {
+		return "", err
+	}
+
+	if err := CreateGitBranchTo(branchName); err != nil {
+		return "", err
+	}
+
+	return branchName, nil
+}
+
+// suggestHotfixTag bumps the patch version of the latest release, ignoring release candidates
+// and service tags, which are not on the release branch.
+func suggestHotfixTag(tags []string) (string, error) {
+	return BumpTagVersion(getLatestReleaseTag(tags), TagVersionPatch)
+}
+
+func InputHotfixTag() (string, error) {
+	tags, err := listVersionTags()
+	if err != nil {
+		return "", err
+	}
+
+	next, err := suggestHotfixTag(tags)
+	if err != nil {
+		return "", err
+	}
+
+	value := ""
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the hotfix tag:",
+		Default: next,
+	}, &value, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	value = strings.TrimSpace(value)
+	if !releaseTagRegex.MatchString(value) {
+		return "", fmt.Errorf("invalid tag name: %s", value)
+	}
+
+	return value, nil
+}
+
+// NewHotfixFinishState merges the current hotfix into release, tags it and back-merges
+// release into staging and develop. The returned state stops safely on conflicts like a branch sync.
+func NewHotfixFinishState(tag string) (*BranchSyncState, error) {
+	current, err := GetGitBranchName()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, _, name := deconstructSubBranchName(current)
+	if prefix != gitBranchPrefixHotfix {
+		return nil, fmt.Errorf("current branch is not a hotfix branch: %s", current)
+	}
+
+	branches, err := listGitBranches()
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(branches, GitBranchPrefixRelease) {
+		return nil, fmt.Errorf("release branch not found")
+	}
+
+	state := &BranchSyncState{
+		Origin:    GitBranchPrefixRelease,
+		Direction: BranchSyncDirectionHotfix,
+		Strategy:  BranchSyncStrategyMerge,
+		Steps: []BranchSyncStep{{
+			Target: GitBranchPrefixRelease,
+			Source: current,
+			Result: branchSyncResultPending,
+			Tag:    tag,
+			Memo:   fmt.Sprintf("hotfix: %s", name),
+		}},
+	}
+
+	source := GitBranchPrefixRelease
+	for _, target := range []string{gitBranchPrefixStaging, gitBranchPrefixDevelop} {
+		if !slices.Contains(branches, target) {
+			continue
+		}
+
+		state.Steps = append(state.Steps, BranchSyncStep{
+			Target: target,
+			Source: source,
+			Result: branchSyncResultPending,
+		})
+		source = target
+	}
+
+	return state, nil
+}
@@ -0,0 +1,168 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/fatih/color"
+)
+
+type DiffHunk struct {
+	Header string
+	Lines  []string
+}
+
+type FileDiff struct {
+	Path   string
+	Header []string
+	Hunks  []DiffHunk
+}
+
+func parseFileDiff(path string, output []byte) *FileDiff {
+	diff := &FileDiff{Path: path}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	var hunk *DiffHunk
+	for _, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			diff.Hunks = append(diff.Hunks, DiffHunk{Header: line})
+			hunk = &diff.Hunks[len(diff.Hunks)-1]
+			continue
+		}
+
+		if hunk == nil {
+			diff.Header = append(diff.Header, line)
+			continue
+		}
+
+		hunk.Lines = append(hunk.Lines, line)
+	}
+
+	return diff
+}
+
+func GetUnstagedFileDiff(path string) (*FileDiff, error) {
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "-U3", "--", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFileDiff(path, output), nil
+}
+
+// Patch builds a patch containing only the selected hunks. Line numbers are fixed up by 'git apply --recount'.
+func (d *FileDiff) Patch(selected []int) string {
+	builder := strings.Builder{}
+	for _, line := range d.Header {
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+
+	for _, i := range selected {
+		builder.WriteString(d.Hunks[i].Header)
+		builder.WriteString("\n")
+		for _, line := range d.Hunks[i].Lines {
+			builder.WriteString(line)
+			builder.WriteString("\n")
+		}
+	}
+
+	return builder.String()
+}
+
+func ApplyCachedPatch(patch string) error {
+	cmd := exec.Command("git", "apply", "--cached", "--recount", "-")
+	cmd.Stdin = strings.NewReader(patch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
+
+func (h *DiffHunk) print() {
+	fmt.Println(color.CyanString(h.Header))
+	for _, line := range h.Lines {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(color.GreenString(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(color.RedString(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+// SelectHunksToStage asks for every hunk of the file, like 'git add -p', and returns the selected hunk indexes.
+func SelectHunksToStage(diff *FileDiff) ([]int, error) {
+	const (
+		stage     = "Stage this hunk"
+		skip      = "Skip this hunk"
+		stageRest = "Stage this and remaining hunks"
+		skipRest  = "Skip this and remaining hunks"
+	)
+
+	selected := make([]int, 0, len(diff.Hunks))
+	for i := range diff.Hunks {
+		fmt.Println(color.New(color.Bold).Sprintf("%s (%d/%d)", diff.Path, i+1, len(diff.Hunks)))
+		diff.Hunks[i].print()
+
+		answer := ""
+		if err := survey.AskOne(&survey.Select{
+			Message: "Stage this hunk?",
+			Options: []string{stage, skip, stageRest, skipRest},
+		}, &answer, survey.WithValidator(survey.Required)); err != nil {
+			return nil, err
+		}
+
+		switch answer {
+		case stage:
+			selected = append(selected, i)
+		case stageRest:
+			for j := i; j < len(diff.Hunks); j++ {
+				selected = append(selected, j)
+			}
+			return selected, nil
+		case skipRest:
+			return selected, nil
+		}
+	}
+
+	return selected, nil
+}
+
+// StageFileHunks interactively stages parts of a modified file. Other files and files without
+// hunks, such as binary files or pure mode changes, are staged as a whole.
+func StageFileHunks(file *UnstagedFile) error {
+	if file.Type != FileTypeModified {
+		return StageFiles([]*UnstagedFile{file})
+	}
+
+	diff, err := GetUnstagedFileDiff(file.Path)
+	if err != nil {
+		return err
+	}
+
+	if len(diff.Hunks) == 0 {
+		return StageFiles([]*UnstagedFile{file})
+	}
+
+	selected, err := SelectHunksToStage(diff)
+	if err != nil {
+		return err
+	}
+
+	if len(selected) == 0 {
+		return nil
+	}
+
+	if err := ApplyCachedPatch(diff.Patch(selected)); err != nil {
+		return err
+	}
+
+	return nil
+}
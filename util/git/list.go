@@ -4,32 +4,53 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
 )
 
 const (
-	FileTypeUntracked = "untracked"
-	FileTypeModified  = "modified"
-	FileTypeDeleted   = "deleted"
+	FileTypeUntracked   = "untracked"
+	FileTypeModified    = "modified"
+	FileTypeDeleted     = "deleted"
+	FileTypeAdded       = "added"
+	FileTypeRenamed     = "renamed"
+	FileTypeCopied      = "copied"
+	FileTypeModeChanged = "mode"
+	FileTypeUnmerged    = "unmerged"
 )
 
 var fileTypeShortCutMap = map[string]string{
-	FileTypeUntracked: "NEW",
-	FileTypeModified:  "MOD",
-	FileTypeDeleted:   "DEL",
+	FileTypeUntracked:   "NEW",
+	FileTypeModified:    "MOD",
+	FileTypeDeleted:     "DEL",
+	FileTypeAdded:       "ADD",
+	FileTypeRenamed:     "REN",
+	FileTypeCopied:      "CPY",
+	FileTypeModeChanged: "CHM",
+	FileTypeUnmerged:    "UNM",
 }
 
 var fileTypeLongCutMap = map[string]string{
 	"NEW": "untracked",
 	"MOD": "modified",
 	"DEL": "deleted",
+	"ADD": "added",
+	"REN": "renamed",
+	"CPY": "copied",
+	"CHM": "mode",
+	"UNM": "unmerged",
 }
 
 type UnstagedFile struct {
 	Type string
 	Path string
+	// OrigPath is the source path of a rename or copy.
+	OrigPath string
+	// PartlyStaged is set when some changes of the file are already staged.
+	PartlyStaged bool
 }
 
 const (
@@ -37,7 +58,16 @@ const (
 )
 
 func (u *UnstagedFile) String() string {
-	return fmt.Sprintf(unstagedFileStringFormat, fileTypeShortCutMap[u.Type], u.Path)
+	path := u.Path
+	if u.OrigPath != "" {
+		path = u.OrigPath + " -> " + u.Path
+	}
+
+	if u.PartlyStaged {
+		path += " (partly staged)"
+	}
+
+	return fmt.Sprintf(unstagedFileStringFormat, fileTypeShortCutMap[u.Type], path)
 }
 
 func ListUnstagedFiles() ([]*UnstagedFile, error) {
@@ -93,17 +123,72 @@ func ListUntrackedFiles() ([]*UnstagedFile, error) {
 }
 
 func ListUnstagedFilesWithType() ([]*UnstagedFile, error) {
-	files, err := ListUnstagedFiles()
+	entries, err := ListGitStatus()
 	if err != nil {
 		return nil, err
 	}
 
-	untrackedFiles, err := ListUntrackedFiles()
+	files := make([]*UnstagedFile, 0, len(entries))
+	untrackedFiles := make([]*UnstagedFile, 0)
+	for _, entry := range entries {
+		if !entry.IsUnstaged() {
+			continue
+		}
+
+		switch entry.Kind {
+		case statusEntryUntracked:
+			untrackedFiles = append(untrackedFiles, &UnstagedFile{
+				Type: FileTypeUntracked,
+				Path: entry.Path,
+			})
+		case statusEntryUnmerged:
+			files = append(files, &UnstagedFile{
+				Type: FileTypeUnmerged,
+				Path: entry.Path,
+			})
+		default:
+			file := &UnstagedFile{
+				Type:         statusCodeToFileType(entry.Worktree, entry.ModeIndex != entry.ModeWorktree),
+				Path:         entry.Path,
+				PartlyStaged: entry.IsStaged(),
+			}
+
+			if entry.Worktree == 'R' || entry.Worktree == 'C' {
+				file.OrigPath = entry.OrigPath
+			}
+
+			files = append(files, file)
+		}
+	}
+
+	files = append(files, untrackedFiles...)
+
+	return files, nil
+}
+
+func ListStagedFiles() ([]*UnstagedFile, error) {
+	entries, err := ListGitStatus()
 	if err != nil {
 		return nil, err
 	}
 
-	files = append(files, untrackedFiles...)
+	files := make([]*UnstagedFile, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsStaged() || entry.Kind == statusEntryUnmerged {
+			continue
+		}
+
+		file := &UnstagedFile{
+			Type: statusCodeToFileType(entry.Index, false),
+			Path: entry.Path,
+		}
+
+		if entry.Index == 'R' || entry.Index == 'C' {
+			file.OrigPath = entry.OrigPath
+		}
+
+		files = append(files, file)
+	}
 
 	return files, nil
 }
@@ -147,6 +232,9 @@ func StageFiles(files []*UnstagedFile) error {
 
 	filePaths := make([]string, 0, len(files))
 	for _, file := range files {
+		if file.OrigPath != "" && file.Type == FileTypeRenamed {
+			filePaths = append(filePaths, file.OrigPath)
+		}
 		filePaths = append(filePaths, file.Path)
 	}
 
@@ -173,3 +261,27 @@ func UnstageFiles(files []*UnstagedFile) error {
 
 	return nil
 }
+
+func ListStagedGoPackages() ([]string, error) {
+	cmd := exec.Command("git", "diff", "--cached", "--name-only", "--diff-filter=ACMR")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]string, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.HasSuffix(line, ".go") {
+			continue
+		}
+
+		pkg := "./" + filepath.ToSlash(filepath.Dir(line))
+		if !slices.Contains(packages, pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+
+	slices.Sort(packages)
+
+	return packages, nil
+}
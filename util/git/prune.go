@@ -0,0 +1,189 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+var protectedBranchPrefixes = []string{GitBranchPrefixRelease, gitBranchPrefixStaging, gitBranchPrefixDevelop}
+
+const (
+	pruneReasonMerged = "merged"
+	pruneReasonStale  = "stale"
+)
+
+type PrunableBranch struct {
+	BranchStatus
+	Reason string
+}
+
+func (p *PrunableBranch) String() string {
+	return fmt.Sprintf("%s (%s)", p.Name, p.Reason)
+}
+
+func InputStaleDays() (int, error) {
+	days := 0
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the number of days without commits to treat a branch as stale",
+		Default: "30",
+	}, &days, survey.WithValidator(survey.Required)); err != nil {
+		return 0, err
+	}
+
+	if days <= 0 {
+		return 0, fmt.Errorf("number of days must be positive")
+	}
+
+	return days, nil
+}
+
+func isProtectedBranch(branchName string) bool {
+	prefix, _, _ := deconstructSubBranchName(branchName)
+	return slices.Contains(protectedBranchPrefixes, prefix)
+}
+
+func ListPrunableBranches(staleDays int) ([]PrunableBranch, error) {
+	current, err := GetGitBranchName()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := ListBranchStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	staleBefore := time.Now().AddDate(0, 0, -staleDays)
+	prunable := make([]PrunableBranch, 0)
+	for _, status := range statuses {
+		if status.Name == current || isProtectedBranch(status.Name) {
+			continue
+		}
+
+		// Only branches that follow the ako naming rules and have their parent checked out
+		// locally are candidates, so main, master and vendor branches are never offered.
+		if ValidateGitBranchName(status.Name) != nil || status.Parent == "" {
+			continue
+		}
+
+		switch {
+		case status.Parent != "" && status.Merged:
+			prunable = append(prunable, PrunableBranch{BranchStatus: status, Reason: pruneReasonMerged})
+		case status.LastCommitAt.Before(staleBefore):
+			prunable = append(prunable, PrunableBranch{BranchStatus: status, Reason: pruneReasonStale})
+		}
+	}
+
+	return prunable, nil
+}
+
+func PrintPrunableBranches(branches []PrunableBranch) {
+	tbl := table.NewTableBuilder("BRANCH", "PARENT", "REASON", "LAST COMMIT", "AUTHOR", "AHEAD", "BEHIND")
+	for _, branch := range branches {
+		tbl.AppendRow(branch.Name, branch.Parent, branch.Reason, branch.LastCommitAt.Format(time.DateOnly), branch.Author, strconv.Itoa(branch.Ahead), strconv.Itoa(branch.Behind))
+	}
+	tbl.Print()
+}
+
+func SelectBranchesToPrune(branches []PrunableBranch) ([]PrunableBranch, error) {
+	if len(branches) == 0 {
+		return nil, nil
+	}
+
+	candidates := make([]string, 0, len(branches))
+	for _, branch := range branches {
+		candidates = append(candidates, branch.String())
+	}
+
+	var selected []string
+	if err := survey.AskOne(&survey.MultiSelect{
+		Message: "Select branches to delete:",
+		Options: candidates,
+		Help:    "Use space to select, enter to confirm",
+	}, &selected); err != nil {
+		return nil, err
+	}
+
+	selectedBranches := make([]PrunableBranch, 0, len(selected))
+	for _, s := range selected {
+		for _, branch := range branches {
+			if s == branch.String() {
+				selectedBranches = append(selectedBranches, branch)
+				break
+			}
+		}
+	}
+
+	return selectedBranches, nil
+}
+
+func ConfirmStaleBranchDeletion(branches []PrunableBranch) ([]PrunableBranch, error) {
+	stale := 0
+	for _, branch := range branches {
+		if branch.Reason == pruneReasonStale {
+			stale++
+		}
+	}
+
+	if stale == 0 {
+		return branches, nil
+	}
+
+	force := false
+	if err := survey.AskOne(&survey.Confirm{
+		Message: fmt.Sprintf("%d stale branches may have unmerged commits, force delete them?", stale),
+		Default: false,
+	}, &force); err != nil {
+		return nil, err
+	}
+
+	if force {
+		return branches, nil
+	}
+
+	confirmed := make([]PrunableBranch, 0, len(branches)-stale)
+	for _, branch := range branches {
+		if branch.Reason != pruneReasonStale {
+			confirmed = append(confirmed, branch)
+		}
+	}
+
+	return confirmed, nil
+}
+
+// DeletePrunableBranch deletes merged branches with git branch -d, which refuses unmerged work,
+// and force deletes stale branches, which must be confirmed with ConfirmStaleBranchDeletion first.
+func DeletePrunableBranch(branch PrunableBranch) error {
+	flag := "-d"
+	if branch.Reason == pruneReasonStale {
+		flag = "-D"
+	}
+
+	cmd := exec.Command("git", "branch", flag, branch.Name)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func DeleteRemoteGitBranch(branchName string) error {
+	cmd := exec.Command("git", "push", "origin", "--delete", branchName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
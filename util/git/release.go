@@ -0,0 +1,201 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+)
+
+var (
+	releaseTagRegex          = regexp.MustCompile(`^v\d+\.\d+\.\d+$`)
+	releaseCandidateTagRegex = regexp.MustCompile(`^v\d+\.\d+\.\d+-rc\.\d+$`)
+)
+
+// GetPromotionTarget returns the next branch up in the release pipeline: develop → staging → release.
+func GetPromotionTarget(source string) (string, error) {
+	switch source {
+	case gitBranchPrefixDevelop:
+		return gitBranchPrefixStaging, nil
+	case gitBranchPrefixStaging:
+		return GitBranchPrefixRelease, nil
+	}
+
+	return "", fmt.Errorf("only %s and %s can be promoted, current branch is %s", gitBranchPrefixDevelop, gitBranchPrefixStaging, source)
+}
+
+func fetchGitRemote() error {
+	cmd := exec.Command("git", "fetch", "origin")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsGitBranchUpToDate reports whether branchName contains every commit of its remote counterpart.
+// Repositories without origin and branches without a remote counterpart are considered up to date.
+func IsGitBranchUpToDate(branchName string) (bool, error) {
+	if err := exec.Command("git", "remote", "get-url", "origin").Run(); err != nil {
+		return true, nil
+	}
+
+	if err := fetchGitRemote(); err != nil {
+		return false, err
+	}
+
+	remote := "origin/" + branchName
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", remote).Run(); err != nil {
+		return true, nil
+	}
+
+	_, behind, err := countGitAheadBehind(branchName, remote)
+	if err != nil {
+		return false, err
+	}
+
+	return behind == 0, nil
+}
+
+func listVersionTags() ([]string, error) {
+	output, err := exec.Command("git", "tag", "--list", "v*", "--sort=-v:refname").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0)
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			tags = append(tags, string(line))
+		}
+	}
+
+	return tags, nil
+}
+
+func getLatestReleaseTag(tags []string) string {
+	for _, tag := range tags {
+		if releaseTagRegex.MatchString(tag) {
+			return tag
+		}
+	}
+
+	return ""
+}
+
+func makeReleaseCandidateTag(version string, tags []string) string {
+	count := 0
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, version+"-rc.") {
+			count++
+		}
+	}
+
+	return fmt.Sprintf("%s-rc.%d", version, count+1)
+}
+
+// InputReleaseTag proposes the next version for target. Promotions into staging get a
+// release candidate tag, promotions into release reuse the pending release candidate version.
+func InputReleaseTag(target string) (string, error) {
+	tags, err := listVersionTags()
+	if err != nil {
+		return "", err
+	}
+
+	latestRelease := getLatestReleaseTag(tags)
+
+	next := ""
+	if target == GitBranchPrefixRelease && len(tags) > 0 {
+		if base, _, ok := strings.Cut(tags[0], "-rc."); ok && base != latestRelease {
+			next = base
+		}
+	}
+
+	if next == "" {
+		part := ""
+		if err := survey.AskOne(&survey.Select{
+			Message: fmt.Sprintf("Select version bump [latest: %s]", latestRelease),
+			Options: []string{TagVersionPatch, TagVersionMinor, TagVersionMajor},
+			Default: TagVersionMinor,
+		}, &part, survey.WithValidator(survey.Required)); err != nil {
+			return "", err
+		}
+
+		next, err = BumpTagVersion(latestRelease, part)
+		if err != nil {
+			return "", err
+		}
+
+		if target == gitBranchPrefixStaging {
+			next = makeReleaseCandidateTag(next, tags)
+		}
+	}
+
+	value := ""
+	if err := survey.AskOne(&survey.Input{
+		Message: "Enter the release tag:",
+		Default: next,
+	}, &value, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	value = strings.TrimSpace(value)
+	tagRegex := releaseTagRegex
+	if target == gitBranchPrefixStaging {
+		tagRegex = releaseCandidateTagRegex
+	}
+	if !tagRegex.MatchString(value) {
+		return "", fmt.Errorf("invalid tag name: %s", value)
+	}
+
+	return value, nil
+}
+
+// GenerateReleaseChangelog lists the changes of source since the latest release tag.
+func GenerateReleaseChangelog(source string) (string, error) {
+	tags, err := listVersionTags()
+	if err != nil {
+		return "", err
+	}
+
+	revRange := source
+	if latest := getLatestReleaseTag(tags); latest != "" {
+		revRange = latest + ".." + source
+	}
+
+	return GenerateChangelog(revRange)
+}
+
+// NewPromotionState merges source into target and tags the result. It ends on target so that it can be pushed.
+func NewPromotionState(source string, target string, tag string, memo string) *BranchSyncState {
+	return &BranchSyncState{
+		Origin:    target,
+		Direction: BranchSyncDirectionUp,
+		Strategy:  BranchSyncStrategyMerge,
+		Steps: []BranchSyncStep{{
+			Target: target,
+			Source: source,
+			Result: branchSyncResultPending,
+			Tag:    tag,
+			Memo:   memo,
+		}},
+	}
+}
+
+func PushGitBranch(branchName string) error {
+	cmd := exec.Command("git", "push", "origin", branchName)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -1,6 +1,11 @@
 package git
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
 
 func GenerateCommitMessageRule() error {
 	const llmCommitPrompt = `
@@ -81,3 +86,55 @@ You are an AI assistant tasked with generating commit messages that strictly adh
 
 	return nil
 }
+
+var conventionalCommitTypes = []string{"init", "feat", "fix", "build", "chore", "ci", "docs", "style", "refactor", "perf", "test"}
+
+var conventionalCommitRegex = regexp.MustCompile(`^([a-z]+)(\(([^()\s]+)\))?(!)?: (.+)$`)
+
+// isGeneratedCommitMessage reports messages written by git itself, which are not expected to follow the convention.
+func isGeneratedCommitMessage(message string) bool {
+	for _, prefix := range []string{"Merge ", "Revert ", "fixup! ", "squash! ", "amend! "} {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ValidateCommitMessage(message string) error {
+	for _, issue := range LintCommitMessage(message, "") {
+		if issue.Level == CommitLintLevelError {
+			return fmt.Errorf("%s: %s", issue.Rule, issue.Message)
+		}
+	}
+
+	return nil
+}
+
+func ValidateGitBranchName(branchName string) error {
+	parts := strings.Split(branchName, "/")
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid branch name: %s", branchName)
+		}
+	}
+
+	expected := 0
+	switch parts[0] {
+	case GitBranchPrefixRelease, gitBranchPrefixStaging, gitBranchPrefixDevelop:
+		expected = 1
+	case gitBranchPrefixEpic, gitBranchPrefixHotfix:
+		expected = 2
+	case gitBranchPrefixFeature, gitBranchPrefixPatch, gitBranchPrefixBreak, gitBranchPrefixProposal:
+		expected = 3
+	default:
+		return fmt.Errorf("invalid branch prefix: %s", parts[0])
+	}
+
+	if len(parts) != expected {
+		return fmt.Errorf("branch %s must have %d path segment(s), got %d", branchName, expected, len(parts))
+	}
+
+	return nil
+}
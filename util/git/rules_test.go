@@ -0,0 +1,81 @@
+package git
+
+import "testing"
+
+func TestValidateCommitMessage(t *testing.T) {
+	tests := []struct {
+		message string
+		valid   bool
+	}{
+		{"feat(auth): implement user logout functionality", true},
+		{"refactor(api)!: overhaul endpoint structure for v2", true},
+		{"chore: update build dependencies to latest versions", true},
+		{"Merge branch 'develop' into epic/payment", true},
+		{"feat: Add login", false},
+		{"fix: correct button alignment.", false},
+		{"feature(auth): add login", false},
+		{"add login", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateCommitMessage(tt.message)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateCommitMessage(%q) = %v, want valid %v", tt.message, err, tt.valid)
+		}
+	}
+}
+
+func TestValidateGitBranchName(t *testing.T) {
+	tests := []struct {
+		branch string
+		valid  bool
+	}{
+		{"release", true},
+		{"develop", true},
+		{"epic/payment", true},
+		{"feature/payment/card", true},
+		{"proposal/card/3ds", true},
+		{"hotfix/login-crash", true},
+		{"hotfix", false},
+		{"feature/card", false},
+		{"epic/payment/card", false},
+		{"fix-thing", false},
+		{"epic/", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateGitBranchName(tt.branch)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateGitBranchName(%q) = %v, want valid %v", tt.branch, err, tt.valid)
+		}
+	}
+}
+
+func TestLintCommitMessageBranchHint(t *testing.T) {
+	tests := []struct {
+		message string
+		branch  string
+		rules   []string
+	}{
+		{"feat(card): add 3ds support", "feature/payment/card", nil},
+		{"fix(card): handle timeout", "feature/payment/card", []string{commitLintRuleBranchType}},
+		{"feat(card)!: drop legacy api", "patch/payment/card", []string{commitLintRuleBranchType, commitLintRuleBreakingChange}},
+		{"refactor(card)!: drop legacy api", "break/payment/card", nil},
+		{"feat(card): added 3ds support", "", []string{commitLintRuleSubjectImperative}},
+	}
+
+	for _, tt := range tests {
+		issues := LintCommitMessage(tt.message, tt.branch)
+		if len(issues) != len(tt.rules) {
+			t.Errorf("LintCommitMessage(%q, %q) = %v, want rules %v", tt.message, tt.branch, issues, tt.rules)
+			continue
+		}
+
+		for i, issue := range issues {
+			if issue.Rule != tt.rules[i] {
+				t.Errorf("LintCommitMessage(%q, %q) rule %d = %s, want %s", tt.message, tt.branch, i, issue.Rule, tt.rules[i])
+			}
+		}
+	}
+}
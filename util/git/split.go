@@ -0,0 +1,326 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+const maxSplitUntrackedLines = 100
+
+type CommitSplitFile struct {
+	Path  string `yaml:"path"`
+	Hunks []int  `yaml:"hunks,omitempty"`
+}
+
+// CommitSplitGroup is a single commit of a split plan. Hunk numbers are 1-based, as shown to the LLM.
+type CommitSplitGroup struct {
+	Message string            `yaml:"message"`
+	Files   []CommitSplitFile `yaml:"files"`
+}
+
+// SplitChanges holds the unstaged changes that a split plan refers to.
+type SplitChanges struct {
+	Files []*UnstagedFile
+	Diffs map[string]*FileDiff
+}
+
+func CollectSplitChanges() (*SplitChanges, error) {
+	files, err := ListUnstagedFilesWithType()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &SplitChanges{
+		Files: files,
+		Diffs: make(map[string]*FileDiff),
+	}
+
+	for _, file := range files {
+		if file.Type != FileTypeModified {
+			continue
+		}
+
+		diff, err := GetUnstagedFileDiff(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(diff.Hunks) > 0 {
+			changes.Diffs[file.Path] = diff
+		}
+	}
+
+	return changes, nil
+}
+
+func readUntrackedFileHead(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(data, 0) != -1 {
+		return "", false
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) > maxSplitUntrackedLines {
+		lines = append(lines[:maxSplitUntrackedLines], "... (truncated)")
+	}
+
+	return strings.Join(lines, "\n"), true
+}
+
+// String renders the changes in the format expected by the commit split prompt.
+func (c *SplitChanges) String() string {
+	builder := strings.Builder{}
+	for _, file := range c.Files {
+		builder.WriteString(fmt.Sprintf("### File: %s (%s)\n", file.Path, file.Type))
+
+		if diff, ok := c.Diffs[file.Path]; ok {
+			for i, hunk := range diff.Hunks {
+				builder.WriteString(fmt.Sprintf("#### Hunk %d\n", i+1))
+				builder.WriteString(hunk.Header)
+				builder.WriteString("\n")
+				for _, line := range hunk.Lines {
+					builder.WriteString(line)
+					builder.WriteString("\n")
+				}
+			}
+			continue
+		}
+
+		if file.Type == FileTypeUntracked {
+			if content, ok := readUntrackedFileHead(file.Path); ok {
+				builder.WriteString(content)
+				builder.WriteString("\n")
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+func (c *SplitChanges) findFile(path string) *UnstagedFile {
+	for _, file := range c.Files {
+		if file.Path == path {
+			return file
+		}
+	}
+
+	return nil
+}
+
+func ParseCommitSplitPlan(content string) ([]CommitSplitGroup, error) {
+	groups := make([]CommitSplitGroup, 0)
+	if err := yaml.Unmarshal([]byte(content), &groups); err != nil {
+		return nil, err
+	}
+
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("plan has no commits")
+	}
+
+	for i := range groups {
+		groups[i].Message = strings.TrimSpace(groups[i].Message)
+	}
+
+	return groups, nil
+}
+
+func MarshalCommitSplitPlan(groups []CommitSplitGroup) (string, error) {
+	data, err := yaml.Marshal(groups)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Validate checks that every commit message is valid and that every file and hunk of the plan
+// exists and is used only once. Changes left out of the plan are returned so they can be reported.
+func (c *SplitChanges) Validate(groups []CommitSplitGroup) ([]string, error) {
+	wholeFiles := make(map[string]bool)
+	usedHunks := make(map[string][]int)
+	for i, group := range groups {
+		if err := ValidateCommitMessage(group.Message); err != nil {
+			return nil, fmt.Errorf("commit %d: %w", i+1, err)
+		}
+
+		if len(group.Files) == 0 {
+			return nil, fmt.Errorf("commit %d has no files", i+1)
+		}
+
+		for _, f := range group.Files {
+			if c.findFile(f.Path) == nil {
+				return nil, fmt.Errorf("commit %d: unknown file %s", i+1, f.Path)
+			}
+
+			if wholeFiles[f.Path] {
+				return nil, fmt.Errorf("commit %d: file %s is already committed as a whole", i+1, f.Path)
+			}
+
+			if len(f.Hunks) == 0 {
+				if len(usedHunks[f.Path]) > 0 {
+					return nil, fmt.Errorf("commit %d: file %s is already split into hunks", i+1, f.Path)
+				}
+
+				wholeFiles[f.Path] = true
+				continue
+			}
+
+			diff, ok := c.Diffs[f.Path]
+			if !ok {
+				return nil, fmt.Errorf("commit %d: file %s has no hunks", i+1, f.Path)
+			}
+
+			for _, hunk := range f.Hunks {
+				if hunk < 1 || hunk > len(diff.Hunks) {
+					return nil, fmt.Errorf("commit %d: file %s has no hunk %d", i+1, f.Path, hunk)
+				}
+
+				if slices.Contains(usedHunks[f.Path], hunk) {
+					return nil, fmt.Errorf("commit %d: hunk %d of %s is used twice", i+1, hunk, f.Path)
+				}
+
+				usedHunks[f.Path] = append(usedHunks[f.Path], hunk)
+			}
+		}
+	}
+
+	leftovers := make([]string, 0)
+	for _, file := range c.Files {
+		if wholeFiles[file.Path] {
+			continue
+		}
+
+		diff, ok := c.Diffs[file.Path]
+		if !ok {
+			leftovers = append(leftovers, file.Path)
+			continue
+		}
+
+		for i := range diff.Hunks {
+			if !slices.Contains(usedHunks[file.Path], i+1) {
+				leftovers = append(leftovers, fmt.Sprintf("%s (hunk %d)", file.Path, i+1))
+			}
+		}
+	}
+
+	return leftovers, nil
+}
+
+func (c *SplitChanges) stageGroup(group CommitSplitGroup) error {
+	wholeFiles := make([]*UnstagedFile, 0, len(group.Files))
+	for _, f := range group.Files {
+		if len(f.Hunks) == 0 {
+			wholeFiles = append(wholeFiles, c.findFile(f.Path))
+			continue
+		}
+
+		selected := make([]int, 0, len(f.Hunks))
+		for _, hunk := range f.Hunks {
+			selected = append(selected, hunk-1)
+		}
+		slices.Sort(selected)
+
+		if err := ApplyCachedPatch(c.Diffs[f.Path].Patch(selected)); err != nil {
+			return fmt.Errorf("staging hunks of %s: %w", f.Path, err)
+		}
+	}
+
+	return StageFiles(wholeFiles)
+}
+
+func getGitHeadCommit() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--verify", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("no commit found on the current branch")
+	}
+
+	return string(bytes.TrimSpace(output)), nil
+}
+
+func resetGitSoft(commit string) error {
+	cmd := exec.Command("git", "reset", "--soft", commit)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Apply stages and commits every group in order. If any step fails, the commits created so far
+// are undone and the index is restored, so the working tree ends up as it was before.
+func (c *SplitChanges) Apply(groups []CommitSplitGroup) (err error) {
+	head, err := getGitHeadCommit()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := SnapshotGitIndex()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		log.Println("Rollback split commits")
+		if resetErr := resetGitSoft(head); resetErr != nil {
+			log.Printf("Error resetting to %s: %s", head, resetErr.Error())
+		}
+
+		if restoreErr := RestoreGitIndex(snapshot); restoreErr != nil {
+			log.Printf("Error restoring index: %s", restoreErr.Error())
+		}
+	}()
+
+	for i, group := range groups {
+		if err := c.stageGroup(group); err != nil {
+			return fmt.Errorf("commit %d: %w", i+1, err)
+		}
+
+		if err := CommitGitFiles(group.Message); err != nil {
+			return fmt.Errorf("commit %d: %w", i+1, err)
+		}
+
+		log.Printf("Committed %d/%d: %s", i+1, len(groups), group.Message)
+	}
+
+	return nil
+}
+
+func PrintCommitSplitPlan(groups []CommitSplitGroup) {
+	tbl := table.NewTableBuilder("#", "MESSAGE", "FILE", "HUNKS")
+	for i, group := range groups {
+		for j, f := range group.Files {
+			number, message := "", ""
+			if j == 0 {
+				number, message = strconv.Itoa(i+1), group.Message
+			}
+
+			hunks := "all"
+			if len(f.Hunks) > 0 {
+				numbers := make([]string, 0, len(f.Hunks))
+				for _, hunk := range f.Hunks {
+					numbers = append(numbers, strconv.Itoa(hunk))
+				}
+				hunks = strings.Join(numbers, ",")
+			}
+
+			tbl.AppendRow(number, message, f.Path, hunks)
+		}
+	}
+	tbl.Print()
+}
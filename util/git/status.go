@@ -0,0 +1,159 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	statusEntryOrdinary  = '1'
+	statusEntryRenamed   = '2'
+	statusEntryUnmerged  = 'u'
+	statusEntryUntracked = '?'
+	statusEntryIgnored   = '!'
+)
+
+const statusUnchanged = '.'
+
+// StatusEntry is a single path reported by 'git status --porcelain=v2'.
+type StatusEntry struct {
+	Kind         byte
+	Index        byte
+	Worktree     byte
+	ModeIndex    string
+	ModeWorktree string
+	Path         string
+	OrigPath     string
+}
+
+func (e *StatusEntry) IsStaged() bool {
+	return e.Kind != statusEntryUntracked && e.Index != statusUnchanged
+}
+
+func (e *StatusEntry) IsUnstaged() bool {
+	return e.Kind == statusEntryUntracked || e.Worktree != statusUnchanged
+}
+
+func statusCodeToFileType(code byte, modeChanged bool) string {
+	switch code {
+	case 'A':
+		return FileTypeAdded
+	case 'D':
+		return FileTypeDeleted
+	case 'R':
+		return FileTypeRenamed
+	case 'C':
+		return FileTypeCopied
+	}
+
+	if modeChanged {
+		return FileTypeModeChanged
+	}
+
+	return FileTypeModified
+}
+
+// parseGitStatus parses the NUL separated output of 'git status --porcelain=v2 -z'.
+func parseGitStatus(output []byte) ([]StatusEntry, error) {
+	tokens := bytes.Split(output, []byte{0})
+	entries := make([]StatusEntry, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		token := string(tokens[i])
+		if token == "" {
+			continue
+		}
+
+		switch token[0] {
+		case statusEntryOrdinary:
+			// 1 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <path>
+			fields := strings.SplitN(token, " ", 9)
+			if len(fields) != 9 {
+				return nil, fmt.Errorf("invalid status entry: %s", token)
+			}
+
+			entries = append(entries, StatusEntry{
+				Kind:         statusEntryOrdinary,
+				Index:        fields[1][0],
+				Worktree:     fields[1][1],
+				ModeIndex:    fields[4],
+				ModeWorktree: fields[5],
+				Path:         fields[8],
+			})
+		case statusEntryRenamed:
+			// 2 <XY> <sub> <mH> <mI> <mW> <hH> <hI> <X><score> <path>\0<origPath>
+			fields := strings.SplitN(token, " ", 10)
+			if len(fields) != 10 || i+1 >= len(tokens) {
+				return nil, fmt.Errorf("invalid status entry: %s", token)
+			}
+
+			i++
+			entries = append(entries, StatusEntry{
+				Kind:         statusEntryRenamed,
+				Index:        fields[1][0],
+				Worktree:     fields[1][1],
+				ModeIndex:    fields[4],
+				ModeWorktree: fields[5],
+				Path:         fields[9],
+				OrigPath:     string(tokens[i]),
+			})
+		case statusEntryUnmerged:
+			// u <XY> <sub> <m1> <m2> <m3> <mW> <h1> <h2> <h3> <path>
+			fields := strings.SplitN(token, " ", 11)
+			if len(fields) != 11 {
+				return nil, fmt.Errorf("invalid status entry: %s", token)
+			}
+
+			entries = append(entries, StatusEntry{
+				Kind:     statusEntryUnmerged,
+				Index:    fields[1][0],
+				Worktree: fields[1][1],
+				Path:     fields[10],
+			})
+		case statusEntryUntracked:
+			entries = append(entries, StatusEntry{
+				Kind:     statusEntryUntracked,
+				Index:    statusUnchanged,
+				Worktree: statusUnchanged,
+				Path:     strings.TrimPrefix(token, "? "),
+			})
+		case statusEntryIgnored:
+			continue
+		default:
+			return nil, fmt.Errorf("unknown status entry: %s", token)
+		}
+	}
+
+	return entries, nil
+}
+
+func ListGitStatus() ([]StatusEntry, error) {
+	cmd := exec.Command("git", "status", "--porcelain=v2", "-z", "--untracked-files=all")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGitStatus(output)
+}
+
+// SnapshotGitIndex records the current index as a tree so that it can be restored exactly,
+// including files that were only partly staged.
+func SnapshotGitIndex() (string, error) {
+	output, err := exec.Command("git", "write-tree").Output()
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSpace(output)), nil
+}
+
+func RestoreGitIndex(tree string) error {
+	cmd := exec.Command("git", "read-tree", tree)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, output)
+	}
+
+	return nil
+}
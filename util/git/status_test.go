@@ -0,0 +1,68 @@
+package git
+
+import "testing"
+
+func TestParseGitStatus(t *testing.T) {
+	output := "1 .M N... 100644 100644 100644 aaa aaa main.go\x00" +
+		"1 MM N... 100644 100644 100644 aaa bbb lib/partly staged.go\x00" +
+		"1 .M N... 100644 100644 100755 aaa aaa run.sh\x00" +
+		"2 R. N... 100644 100644 100644 aaa aaa R100 pkg/new.go\x00pkg/old.go\x00" +
+		"? docs/new.md\x00"
+
+	entries, err := parseGitStatus([]byte(output))
+	if err != nil {
+		t.Fatalf("parseGitStatus: %v", err)
+	}
+
+	if len(entries) != 5 {
+		t.Fatalf("len(entries) = %d, want 5", len(entries))
+	}
+
+	if entries[1].Path != "lib/partly staged.go" || !entries[1].IsStaged() || !entries[1].IsUnstaged() {
+		t.Errorf("partly staged entry = %+v", entries[1])
+	}
+
+	if entries[2].ModeIndex == entries[2].ModeWorktree {
+		t.Errorf("mode change entry = %+v", entries[2])
+	}
+
+	if entries[3].Path != "pkg/new.go" || entries[3].OrigPath != "pkg/old.go" || entries[3].IsUnstaged() {
+		t.Errorf("renamed entry = %+v", entries[3])
+	}
+
+	if entries[4].Kind != statusEntryUntracked || entries[4].Path != "docs/new.md" {
+		t.Errorf("untracked entry = %+v", entries[4])
+	}
+}
+
+func TestFileDiffPatch(t *testing.T) {
+	output := "diff --git a/a.txt b/a.txt\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/a.txt\n" +
+		"+++ b/a.txt\n" +
+		"@@ -1,2 +1,2 @@\n" +
+		"-one\n" +
+		"+ONE\n" +
+		" two\n" +
+		"@@ -10,2 +10,2 @@\n" +
+		" ten\n" +
+		"-eleven\n" +
+		"+ELEVEN\n"
+
+	diff := parseFileDiff("a.txt", []byte(output))
+	if len(diff.Header) != 4 || len(diff.Hunks) != 2 {
+		t.Fatalf("parseFileDiff = %d header lines, %d hunks", len(diff.Header), len(diff.Hunks))
+	}
+
+	want := "diff --git a/a.txt b/a.txt\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/a.txt\n" +
+		"+++ b/a.txt\n" +
+		"@@ -10,2 +10,2 @@\n" +
+		" ten\n" +
+		"-eleven\n" +
+		"+ELEVEN\n"
+	if got := diff.Patch([]int{1}); got != want {
+		t.Errorf("Patch = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,434 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+const (
+	BranchSyncDirectionDown   = "down"
+	BranchSyncDirectionUp     = "up"
+	BranchSyncDirectionHotfix = "hotfix"
+)
+
+const (
+	BranchSyncStrategyMerge  = "merge"
+	BranchSyncStrategyRebase = "rebase"
+)
+
+const (
+	branchSyncResultPending  = "pending"
+	branchSyncResultMerged   = "merged"
+	branchSyncResultRebased  = "rebased"
+	branchSyncResultUpToDate = "up-to-date"
+	branchSyncResultConflict = "conflict"
+	branchSyncResultResolved = "resolved"
+)
+
+const branchSyncStateFileName = "ako_branch_sync.yaml"
+
+var ErrBranchSyncConflict = errors.New("branch sync stopped on conflict")
+
+type BranchSyncStep struct {
+	Target string `yaml:"target"`
+	Source string `yaml:"source"`
+	Result string `yaml:"result"`
+	Tag    string `yaml:"tag,omitempty"`
+	Memo   string `yaml:"memo,omitempty"`
+	Tagged bool   `yaml:"tagged,omitempty"`
+}
+
+type BranchSyncState struct {
+	Origin    string           `yaml:"origin"`
+	Direction string           `yaml:"direction"`
+	Strategy  string           `yaml:"strategy"`
+	Steps     []BranchSyncStep `yaml:"steps"`
+}
+
+func SelectBranchSyncDirection() (string, error) {
+	candidates := []string{
+		BranchSyncDirectionDown + ": Propagate the current branch into every descendant branch",
+		BranchSyncDirectionUp + ": Promote the current branch into its parent branch",
+	}
+
+	var selected string
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select sync direction",
+		Options: candidates,
+	}, &selected, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	if selected == candidates[1] {
+		return BranchSyncDirectionUp, nil
+	}
+
+	return BranchSyncDirectionDown, nil
+}
+
+func SelectBranchSyncStrategy() (string, error) {
+	var selected string
+	if err := survey.AskOne(&survey.Select{
+		Message: "Select sync strategy",
+		Options: []string{BranchSyncStrategyMerge, BranchSyncStrategyRebase},
+	}, &selected, survey.WithValidator(survey.Required)); err != nil {
+		return "", err
+	}
+
+	return selected, nil
+}
+
+func collectDescendantBranches(branchName string) ([]BranchSyncStep, error) {
+	steps := make([]BranchSyncStep, 0)
+	queue := []string{branchName}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		prefix, _, _ := deconstructSubBranchName(parent)
+		if prefix == gitBranchPrefixProposal || prefix == gitBranchPrefixHotfix {
+			continue
+		}
+
+		children, err := getChildrenBranchNameOf(parent)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children {
+			steps = append(steps, BranchSyncStep{
+				Target: child,
+				Source: parent,
+				Result: branchSyncResultPending,
+			})
+			queue = append(queue, child)
+		}
+	}
+
+	return steps, nil
+}
+
+func NewBranchSyncState(direction string, strategy string) (*BranchSyncState, error) {
+	current, err := GetGitBranchName()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &BranchSyncState{
+		Origin:    current,
+		Direction: direction,
+		Strategy:  strategy,
+	}
+
+	switch direction {
+	case BranchSyncDirectionDown:
+		steps, err := collectDescendantBranches(current)
+		if err != nil {
+			return nil, err
+		}
+
+		state.Steps = steps
+	case BranchSyncDirectionUp:
+		parents, err := getParentBranchNameOf(current)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(parents) == 0 {
+			return nil, fmt.Errorf("no parent branch found")
+		}
+
+		parent := parents[0]
+		if len(parents) > 1 {
+			if err := survey.AskOne(&survey.Select{
+				Message: "Choose parent branch",
+				Options: parents,
+			}, &parent, survey.WithValidator(survey.Required)); err != nil {
+				return nil, err
+			}
+		}
+
+		// Promotion always merges, rebasing a parent onto its child would rewrite shared history.
+		state.Strategy = BranchSyncStrategyMerge
+		state.Steps = []BranchSyncStep{{
+			Target: parent,
+			Source: current,
+			Result: branchSyncResultPending,
+		}}
+	default:
+		return nil, fmt.Errorf("invalid sync direction: %s", direction)
+	}
+
+	return state, nil
+}
+
+func getBranchSyncStatePath() (string, error) {
+	return getGitPath(branchSyncStateFileName)
+}
+
+func LoadBranchSyncState() (*BranchSyncState, error) {
+	path, err := getBranchSyncStatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	state := &BranchSyncState{}
+	if err := yaml.NewDecoder(f).Decode(state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *BranchSyncState) save() error {
+	path, err := getBranchSyncStatePath()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := yaml.NewEncoder(f).Encode(s); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *BranchSyncState) remove() error {
+	path, err := getBranchSyncStatePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *BranchSyncState) resume() error {
+	mergeInProgress, err := isGitMergeInProgress()
+	if err != nil {
+		return err
+	}
+
+	rebaseInProgress, err := isGitRebaseInProgress()
+	if err != nil {
+		return err
+	}
+
+	if mergeInProgress || rebaseInProgress {
+		return fmt.Errorf("conflict is not resolved yet, commit the merge or run 'git rebase --continue' first")
+	}
+
+	// A conflict is resolved only if its source landed in the target. An aborted merge or rebase
+	// leaves the step to be run again.
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if step.Result != branchSyncResultConflict {
+			continue
+		}
+
+		resolved, err := isGitAncestor(step.Source, step.Target)
+		if err != nil {
+			return err
+		}
+
+		if resolved {
+			step.Result = branchSyncResultResolved
+		} else {
+			step.Result = branchSyncResultPending
+		}
+	}
+
+	return nil
+}
+
+func (s *BranchSyncState) runStep(step *BranchSyncStep) error {
+	upToDate, err := isGitAncestor(step.Source, step.Target)
+	if err != nil {
+		return err
+	}
+
+	if upToDate {
+		step.Result = branchSyncResultUpToDate
+		return nil
+	}
+
+	if err := SwitchGitBranchTo(step.Target); err != nil {
+		return err
+	}
+
+	switch s.Strategy {
+	case BranchSyncStrategyMerge:
+		if err := MergeGitBranch(step.Source); err != nil {
+			return conflictOrError(step, err, isGitMergeInProgress)
+		}
+
+		step.Result = branchSyncResultMerged
+	case BranchSyncStrategyRebase:
+		if err := RebaseGitBranch(step.Source); err != nil {
+			return conflictOrError(step, err, isGitRebaseInProgress)
+		}
+
+		step.Result = branchSyncResultRebased
+	default:
+		return fmt.Errorf("invalid sync strategy: %s", s.Strategy)
+	}
+
+	return nil
+}
+
+// conflictOrError marks the step as conflicted when the failed merge or rebase left a conflict to
+// resolve, and otherwise returns the error as is, leaving the step pending.
+func conflictOrError(step *BranchSyncStep, err error, inProgress func() (bool, error)) error {
+	conflict, checkErr := inProgress()
+	if checkErr != nil {
+		return checkErr
+	}
+
+	if !conflict {
+		return err
+	}
+
+	step.Result = branchSyncResultConflict
+	return ErrBranchSyncConflict
+}
+
+// tag creates the step's tag on the target once the step has been applied, including after a resolved conflict.
+func (step *BranchSyncStep) tag() error {
+	if step.Tag == "" || step.Tagged {
+		return nil
+	}
+
+	if step.Result == branchSyncResultPending || step.Result == branchSyncResultConflict {
+		return nil
+	}
+
+	if err := SetTagOn(step.Tag, step.Memo, step.Target); err != nil {
+		return err
+	}
+
+	step.Tagged = true
+	log.Printf("Tagged %s on %s", step.Tag, step.Target)
+
+	return nil
+}
+
+// Run applies every pending step in order. On conflict, the state is saved so that
+// a later Run continues from the conflicted step once it has been resolved. Other errors
+// are returned without saving, since there is nothing to resolve.
+func (s *BranchSyncState) Run() error {
+	if err := s.resume(); err != nil {
+		return err
+	}
+
+	clean, err := IsGitWorkingTreeClean()
+	if err != nil {
+		return err
+	}
+
+	if !clean {
+		return fmt.Errorf("working tree has uncommitted changes")
+	}
+
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if step.Result == branchSyncResultPending {
+			log.Printf("Syncing %s into %s (%s)", step.Source, step.Target, s.Strategy)
+			if err := s.runStep(step); err != nil {
+				if !errors.Is(err, ErrBranchSyncConflict) {
+					return err
+				}
+
+				if saveErr := s.save(); saveErr != nil {
+					return saveErr
+				}
+
+				return err
+			}
+		}
+
+		if err := step.tag(); err != nil {
+			if saveErr := s.save(); saveErr != nil {
+				return saveErr
+			}
+
+			return err
+		}
+	}
+
+	if err := s.remove(); err != nil {
+		return err
+	}
+
+	if err := SwitchGitBranchTo(s.Origin); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *BranchSyncState) Abort() error {
+	mergeInProgress, err := isGitMergeInProgress()
+	if err != nil {
+		return err
+	}
+
+	if mergeInProgress {
+		if err := abortGitMerge(); err != nil {
+			return err
+		}
+	}
+
+	rebaseInProgress, err := isGitRebaseInProgress()
+	if err != nil {
+		return err
+	}
+
+	if rebaseInProgress {
+		if err := abortGitRebase(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.remove(); err != nil {
+		return err
+	}
+
+	if err := SwitchGitBranchTo(s.Origin); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *BranchSyncState) Print() {
+	tbl := table.NewTableBuilder("TARGET", "SOURCE", "STRATEGY", "RESULT", "TAG")
+	for _, step := range s.Steps {
+		tbl.AppendRow(step.Target, step.Source, s.Strategy, step.Result, step.Tag)
+	}
+	tbl.Print()
+}
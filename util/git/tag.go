@@ -7,9 +7,13 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+
+	"github.com/gosuda/ako/util/table"
 )
 
 func InputTag() (string, error) {
@@ -27,7 +31,7 @@ func InputTag() (string, error) {
 
 	value = strings.TrimSpace(value)
 
-	const regularExpression = `^v\d+\.\d+\.\d+(-\w+.\d+)?$`
+	const regularExpression = `^([\w.-]+/)*v\d+\.\d+\.\d+(-\w+.\d+)?$`
 	regex := regexp.MustCompile(regularExpression)
 	if !regex.MatchString(value) {
 		return "", fmt.Errorf("invalid tag name: %s", value)
@@ -60,8 +64,68 @@ func SetTag(tag string, memo string) error {
 	return nil
 }
 
-func PushTag(tag string) error {
-	cmd := exec.Command("git", "push", "origin", tag)
+func SetTagOn(tag string, memo string, ref string) error {
+	cmd := exec.Command("git", "tag", "-a", tag, "-m", memo, ref)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const (
+	TagVersionMajor = "major"
+	TagVersionMinor = "minor"
+	TagVersionPatch = "patch"
+)
+
+var tagVersionRegex = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)$`)
+
+// splitTagVersion splits a tag such as api/server/v1.2.0 into the '<cmd>/' prefix and the version.
+func splitTagVersion(tag string) (string, string) {
+	i := strings.LastIndex(tag, "/")
+	return tag[:i+1], tag[i+1:]
+}
+
+// BumpTagVersion returns the next semantic version tag after tag, keeping its '<cmd>/' prefix. An
+// empty tag starts from v0.0.0.
+func BumpTagVersion(tag string, part string) (string, error) {
+	prefix, version := splitTagVersion(tag)
+	major, minor, patch := 0, 0, 0
+	if version != "" {
+		matches := tagVersionRegex.FindStringSubmatch(version)
+		if matches == nil {
+			return "", fmt.Errorf("invalid version tag: %s", tag)
+		}
+
+		major, _ = strconv.Atoi(matches[1])
+		minor, _ = strconv.Atoi(matches[2])
+		patch, _ = strconv.Atoi(matches[3])
+	}
+
+	switch part {
+	case TagVersionMajor:
+		major, minor, patch = major+1, 0, 0
+	case TagVersionMinor:
+		minor, patch = minor+1, 0
+	case TagVersionPatch:
+		patch++
+	default:
+		return "", fmt.Errorf("invalid version part: %s", part)
+	}
+
+	return fmt.Sprintf("%sv%d.%d.%d", prefix, major, minor, patch), nil
+}
+
+func PushTag(tags ...string) error {
+	refs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		refs = append(refs, "refs/tags/"+tag)
+	}
+
+	cmd := exec.Command("git", append([]string{"push", "origin"}, refs...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -83,7 +147,7 @@ func DeleteTag(tag string) error {
 }
 
 func DeleteRemoteTag(tag string) error {
-	cmd := exec.Command("git", "push", ":"+tag)
+	cmd := exec.Command("git", "push", "origin", "--delete", "refs/tags/"+tag)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
@@ -114,48 +178,185 @@ func ListLatestTag(count int) ([]string, error) {
 	return tags, nil
 }
 
+const (
+	TagRemoteStatePushed   = "pushed"
+	TagRemoteStateLocal    = "local"
+	TagRemoteStateDiverged = "diverged"
+	TagRemoteStateUnknown  = "unknown"
+)
+
+// tagFields is the for-each-ref format of a tag record. Every field ends with NUL, so subjects may
+// contain any character.
+var tagFields = []string{
+	"%(refname:strip=2)",
+	"%(objecttype)",
+	"%(objectname)",
+	"%(*objectname)",
+	"%(creatordate:iso-strict)",
+	"%(taggername)",
+	"%(taggeremail:trim)",
+	"%(subject)",
+}
+
 type TagInfo struct {
-	Name string
-	Date string
-	Memo string
+	Name      string
+	Date      time.Time
+	Memo      string
+	Annotated bool
+	// Object is the tag object for annotated tags and the commit for lightweight tags.
+	Object string
+	Target string
+	Tagger string
+	// Service is the cmd the tag belongs to, taken from a '<cmd>/vX.Y.Z' tag name. It is empty for project-wide tags.
+	Service string
+	Remote  string
+}
+
+func getTagService(name string) string {
+	i := strings.LastIndex(name, "/")
+	if i == -1 {
+		return ""
+	}
+
+	return name[:i]
+}
+
+func parseGitTags(output []byte) ([]TagInfo, error) {
+	fields := bytes.Split(output, []byte{0})
+	// The output ends with NUL and a newline, which leaves one trailing token.
+	count := len(fields) / len(tagFields)
+	tags := make([]TagInfo, 0, count)
+	for i := 0; i+len(tagFields) <= len(fields); i += len(tagFields) {
+		record := make([]string, len(tagFields))
+		for j := range tagFields {
+			record[j] = string(fields[i+j])
+		}
+		record[0] = strings.TrimLeft(record[0], "\n")
+
+		tag := TagInfo{
+			Name:      record[0],
+			Annotated: record[1] == "tag",
+			Object:    record[2],
+			Target:    record[3],
+			Memo:      record[7],
+			Service:   getTagService(record[0]),
+			Remote:    TagRemoteStateUnknown,
+		}
+
+		if tag.Target == "" {
+			tag.Target = tag.Object
+		}
+
+		if record[4] != "" {
+			date, err := time.Parse(time.RFC3339, record[4])
+			if err != nil {
+				return nil, fmt.Errorf("invalid date of tag %s: %w", tag.Name, err)
+			}
+			tag.Date = date
+		}
+
+		if record[5] != "" {
+			tag.Tagger = fmt.Sprintf("%s <%s>", record[5], record[6])
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// listRemoteTags returns the object of every tag on origin, keyed by tag name.
+func listRemoteTags() (map[string]string, error) {
+	output, err := exec.Command("git", "ls-remote", "--tags", "--refs", "origin").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		object, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+
+		tags[strings.TrimPrefix(ref, "refs/tags/")] = object
+	}
+
+	return tags, nil
 }
 
+// ListTags lists tags from the newest. If origin cannot be reached, the remote state of every tag is unknown.
 func ListTags() ([]TagInfo, error) {
-	// git for-each-ref --format="[{(%(creatordate))}],[{(%(refname:strip=2))}],[{(%(subject))}]" --sort=-creatordate --count=10 refs/tags
-	command := exec.Command("git", "for-each-ref", "--format=\"[{(%(creatordate))}],[{(%(refname:strip=2))}],[{(%(subject))}]\"", "--sort=-creatordate", "refs/tags")
+	format := strings.Join(tagFields, "%00") + "%00"
+	command := exec.Command("git", "for-each-ref", "--format="+format, "--sort=-creatordate", "refs/tags")
 	output, err := command.Output()
 	if err != nil {
 		return nil, err
 	}
 
-	output = bytes.TrimSpace(output)
-	contents := make([][]byte, 0, 4)
-	state := 0
-	prev := 0
-	for i, b := range output {
-		switch state {
-		case 0:
-			if b == '[' && i+2 < len(output) && output[i+1] == '{' && output[i+2] == '(' {
-				prev = i + 3
-				state = 1
-			}
-		case 1:
-			if b == ')' && i+2 < len(output) && output[i+1] == '}' && output[i+2] == ']' {
-				contents = append(contents, output[prev:i])
-				state = 0
-			}
-		}
+	tags, err := parseGitTags(output)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteTags, err := listRemoteTags()
+	if err != nil {
+		return tags, nil
 	}
 
-	tags := make([]TagInfo, len(contents))
-	for i := 0; i < len(contents); i += 3 {
-		if i+2 < len(contents) {
-			idx := i / 3
-			tags[idx].Date = string(contents[i])
-			tags[idx].Name = string(contents[i+1])
-			tags[idx].Memo = string(contents[i+2])
+	for i := range tags {
+		object, ok := remoteTags[tags[i].Name]
+		switch {
+		case !ok:
+			tags[i].Remote = TagRemoteStateLocal
+		case object == tags[i].Object:
+			tags[i].Remote = TagRemoteStatePushed
+		default:
+			tags[i].Remote = TagRemoteStateDiverged
 		}
 	}
 
 	return tags, nil
 }
+
+func SelectTagsToPush(tags []TagInfo) ([]string, error) {
+	candidates := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag.Remote == TagRemoteStateLocal {
+			candidates = append(candidates, tag.Name)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var selected []string
+	if err := survey.AskOne(&survey.MultiSelect{
+		Message: "Select tags to push:",
+		Options: candidates,
+		Help:    "Use space to select, enter to confirm",
+	}, &selected); err != nil {
+		return nil, err
+	}
+
+	return selected, nil
+}
+
+func PrintTags(tags []TagInfo) {
+	tbl := table.NewTableBuilder("TAG", "SERVICE", "TARGET", "CREATED AT", "TAGGER", "REMOTE", "MEMO")
+	for _, tag := range tags {
+		target := tag.Target
+		if len(target) > 7 {
+			target = target[:7]
+		}
+
+		service := tag.Service
+		if service == "" {
+			service = "-"
+		}
+
+		tbl.AppendRow(tag.Name, service, target, tag.Date.Format(time.DateTime), tag.Tagger, tag.Remote, tag.Memo)
+	}
+	tbl.Print()
+}
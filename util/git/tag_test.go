@@ -0,0 +1,75 @@
+package git
+
+import "testing"
+
+func TestParseGitTags(t *testing.T) {
+	output := "api/server/v1.2.0\x00tag\x00aaaa\x00bbbb\x002025-01-02T03:04:05+09:00\x00Alice\x00alice@example.com\x00fix [{(bracket)}], memo\x00\n" +
+		"v0.1.0\x00commit\x00cccc\x00\x002025-01-01T00:00:00Z\x00\x00\x00init\x00\n"
+
+	tags, err := parseGitTags([]byte(output))
+	if err != nil {
+		t.Fatalf("parseGitTags: %v", err)
+	}
+
+	if len(tags) != 2 {
+		t.Fatalf("len(tags) = %d, want 2", len(tags))
+	}
+
+	annotated := tags[0]
+	if annotated.Name != "api/server/v1.2.0" || !annotated.Annotated || annotated.Target != "bbbb" ||
+		annotated.Service != "api/server" || annotated.Tagger != "Alice <alice@example.com>" ||
+		annotated.Memo != "fix [{(bracket)}], memo" {
+		t.Errorf("annotated tag = %+v", annotated)
+	}
+
+	lightweight := tags[1]
+	if lightweight.Name != "v0.1.0" || lightweight.Annotated || lightweight.Target != "cccc" ||
+		lightweight.Service != "" || lightweight.Tagger != "" {
+		t.Errorf("lightweight tag = %+v", lightweight)
+	}
+}
+
+func TestBumpTagVersion(t *testing.T) {
+	cases := []struct {
+		tag  string
+		part string
+		want string
+	}{
+		{"", TagVersionPatch, "v0.0.1"},
+		{"v1.2.3", TagVersionMinor, "v1.3.0"},
+		{"api/server/v1.2.3", TagVersionPatch, "api/server/v1.2.4"},
+		{"worker/v0.9.1", TagVersionMinor, "worker/v0.10.0"},
+	}
+
+	for _, c := range cases {
+		got, err := BumpTagVersion(c.tag, c.part)
+		if err != nil || got != c.want {
+			t.Errorf("BumpTagVersion(%q, %q) = %q, %v, want %q", c.tag, c.part, got, err, c.want)
+		}
+	}
+
+	for _, tag := range []string{"api/latest", "v1.2.3-rc.1"} {
+		if _, err := BumpTagVersion(tag, TagVersionPatch); err == nil {
+			t.Errorf("BumpTagVersion(%q) succeeded, want error", tag)
+		}
+	}
+}
+
+func TestSuggestHotfixTag(t *testing.T) {
+	cases := []struct {
+		tags []string
+		want string
+	}{
+		{nil, "v0.0.1"},
+		{[]string{"v1.3.0-rc.2", "v1.3.0-rc.1", "v1.2.0", "v1.1.0"}, "v1.2.1"},
+		{[]string{"api/server/v2.0.0", "v1.2.0"}, "v1.2.1"},
+		{[]string{"nightly", "v1.2.0"}, "v1.2.1"},
+	}
+
+	for _, c := range cases {
+		got, err := suggestHotfixTag(c.tags)
+		if err != nil || got != c.want {
+			t.Errorf("suggestHotfixTag(%q) = %q, %v, want %q", c.tags, got, err, c.want)
+		}
+	}
+}
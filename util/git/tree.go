@@ -0,0 +1,267 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+type BranchStatus struct {
+	Name         string
+	Parent       string
+	Ahead        int
+	Behind       int
+	LastCommitAt time.Time
+	Author       string
+	Merged       bool
+}
+
+type BranchNode struct {
+	Status   BranchStatus
+	Children []*BranchNode
+}
+
+func listGitBranches() ([]string, error) {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname:short)", "refs/heads")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []string
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			branches = append(branches, string(line))
+		}
+	}
+
+	return branches, nil
+}
+
+func countGitAheadBehind(branchName string, parent string) (int, int, error) {
+	cmd := exec.Command("git", "rev-list", "--left-right", "--count", parent+"..."+branchName)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %s", output)
+	}
+
+	behind, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ahead, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ahead, behind, nil
+}
+
+func getGitLastCommit(branchName string) (time.Time, string, error) {
+	cmd := exec.Command("git", "log", "-1", "--format=%ct%x00%an", branchName)
+	output, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(string(output)), "\x00", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", fmt.Errorf("unexpected log output: %s", output)
+	}
+
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	return time.Unix(unix, 0), parts[1], nil
+}
+
+func getParentBranchOf(branchName string, branches []string) string {
+	parents, err := getParentBranchNameOf(branchName)
+	if err != nil {
+		return ""
+	}
+
+	for _, parent := range parents {
+		if parent != branchName && slices.Contains(branches, parent) {
+			return parent
+		}
+	}
+
+	return ""
+}
+
+// isGitMergedInto reports whether the branch was merged into the parent. A branch without commits of
+// its own is reachable from the parent as well, but its tip is still one of the parent's own commits
+// rather than one brought in by a merge, so it is not counted as merged.
+func isGitMergedInto(branchName string, parent string) (bool, error) {
+	reachable, err := isGitAncestor(branchName, parent)
+	if err != nil || !reachable {
+		return false, err
+	}
+
+	output, err := exec.Command("git", "rev-list", "--first-parent", parent).Output()
+	if err != nil {
+		return false, err
+	}
+
+	tip, err := exec.Command("git", "rev-parse", "--verify", branchName+"^{commit}").Output()
+	if err != nil {
+		return false, err
+	}
+
+	return !slices.Contains(strings.Fields(string(output)), strings.TrimSpace(string(tip))), nil
+}
+
+func GetBranchStatus(branchName string, parent string) (BranchStatus, error) {
+	status := BranchStatus{
+		Name:   branchName,
+		Parent: parent,
+	}
+
+	lastCommitAt, author, err := getGitLastCommit(branchName)
+	if err != nil {
+		return BranchStatus{}, err
+	}
+
+	status.LastCommitAt = lastCommitAt
+	status.Author = author
+
+	if parent == "" {
+		return status, nil
+	}
+
+	ahead, behind, err := countGitAheadBehind(branchName, parent)
+	if err != nil {
+		return BranchStatus{}, err
+	}
+
+	merged, err := isGitMergedInto(branchName, parent)
+	if err != nil {
+		return BranchStatus{}, err
+	}
+
+	status.Ahead = ahead
+	status.Behind = behind
+	status.Merged = merged
+
+	return status, nil
+}
+
+func ListBranchStatuses() ([]BranchStatus, error) {
+	branches, err := listGitBranches()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]BranchStatus, 0, len(branches))
+	for _, branch := range branches {
+		status, err := GetBranchStatus(branch, getParentBranchOf(branch, branches))
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func BuildBranchTree() ([]*BranchNode, error) {
+	statuses, err := ListBranchStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*BranchNode, len(statuses))
+	for _, status := range statuses {
+		nodes[status.Name] = &BranchNode{Status: status}
+	}
+
+	roots := make([]*BranchNode, 0)
+	for _, status := range statuses {
+		node := nodes[status.Name]
+		parent, ok := nodes[status.Parent]
+		if !ok {
+			roots = append(roots, node)
+			continue
+		}
+
+		parent.Children = append(parent.Children, node)
+	}
+
+	return roots, nil
+}
+
+func (n *BranchNode) label() string {
+	s := n.Status
+	builder := strings.Builder{}
+	builder.WriteString(color.New(color.Bold).Sprint(s.Name))
+
+	if s.Parent != "" {
+		builder.WriteString(" ")
+		builder.WriteString(color.GreenString("↑%d", s.Ahead))
+		builder.WriteString(" ")
+		builder.WriteString(color.RedString("↓%d", s.Behind))
+	}
+
+	builder.WriteString(" ")
+	builder.WriteString(s.LastCommitAt.Format(time.DateOnly))
+	builder.WriteString(" ")
+	builder.WriteString(color.CyanString(s.Author))
+
+	if s.Parent != "" {
+		builder.WriteString(" ")
+		if s.Merged {
+			builder.WriteString(color.GreenString("merged"))
+		} else {
+			builder.WriteString(color.YellowString("unmerged"))
+		}
+	}
+
+	return builder.String()
+}
+
+func (n *BranchNode) write(builder *strings.Builder, indent string, last bool) {
+	branch := "├── "
+	next := "│   "
+	if last {
+		branch = "└── "
+		next = "    "
+	}
+
+	builder.WriteString(indent)
+	builder.WriteString(branch)
+	builder.WriteString(n.label())
+	builder.WriteString("\n")
+
+	for i, child := range n.Children {
+		child.write(builder, indent+next, i == len(n.Children)-1)
+	}
+}
+
+func (n *BranchNode) String() string {
+	builder := strings.Builder{}
+	builder.WriteString(n.label())
+	builder.WriteString("\n")
+
+	for i, child := range n.Children {
+		child.write(&builder, "", i == len(n.Children)-1)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,338 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+
+	"github.com/gosuda/ako/util/table"
+)
+
+const worktreeDirSuffix = ".worktrees"
+
+type Worktree struct {
+	Path     string
+	Branch   string
+	Head     string
+	Bare     bool
+	Detached bool
+	Locked   bool
+	Prunable bool
+}
+
+func (w *Worktree) String() string {
+	if w.Branch == "" {
+		return w.Path
+	}
+
+	return fmt.Sprintf("%s (%s)", w.Branch, w.Path)
+}
+
+func (w *Worktree) state() string {
+	states := make([]string, 0)
+	if w.Bare {
+		states = append(states, "bare")
+	}
+	if w.Detached {
+		states = append(states, "detached")
+	}
+	if w.Locked {
+		states = append(states, "locked")
+	}
+	if w.Prunable {
+		states = append(states, "prunable")
+	}
+
+	return strings.Join(states, ",")
+}
+
+// parseGitWorktrees parses the output of 'git worktree list --porcelain'. The first entry is the main worktree.
+func parseGitWorktrees(output []byte) []Worktree {
+	worktrees := make([]Worktree, 0)
+	var current *Worktree
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "worktree":
+			worktrees = append(worktrees, Worktree{Path: value})
+			current = &worktrees[len(worktrees)-1]
+		case "HEAD":
+			current.Head = value
+		case "branch":
+			current.Branch = strings.TrimPrefix(value, "refs/heads/")
+		case "bare":
+			current.Bare = true
+		case "detached":
+			current.Detached = true
+		case "locked":
+			current.Locked = true
+		case "prunable":
+			current.Prunable = true
+		}
+	}
+
+	return worktrees
+}
+
+func ListGitWorktrees() ([]Worktree, error) {
+	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGitWorktrees(output), nil
+}
+
+// FindGitWorktreeOf returns the worktree where the branch is checked out, or nil if there is none.
+func FindGitWorktreeOf(branchName string) (*Worktree, error) {
+	worktrees, err := ListGitWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range worktrees {
+		if worktrees[i].Branch == branchName {
+			return &worktrees[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func getGitTopLevel() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSpace(output)), nil
+}
+
+// GetWorktreeDirOf returns the directory of the branch's worktree. Worktrees live next to the
+// main worktree, in '<repository>.worktrees/<branch path>'.
+func GetWorktreeDirOf(branchName string) (string, error) {
+	worktrees, err := ListGitWorktrees()
+	if err != nil {
+		return "", err
+	}
+
+	if len(worktrees) == 0 {
+		return "", fmt.Errorf("no main worktree found")
+	}
+
+	main := worktrees[0].Path
+	return filepath.Join(filepath.Dir(main), filepath.Base(main)+worktreeDirSuffix, filepath.FromSlash(branchName)), nil
+}
+
+// AddGitWorktree checks out the branch into its own worktree. If create is set, the branch is
+// created from the current HEAD.
+func AddGitWorktree(branchName string, create bool) (string, error) {
+	dir, err := GetWorktreeDirOf(branchName)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"worktree", "add"}
+	if create {
+		args = append(args, "-b", branchName, dir)
+	} else {
+		args = append(args, dir, branchName)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func RemoveGitWorktree(path string, force bool) error {
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, path)
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListBranchesWithoutWorktree returns the local branches that are not checked out in any worktree.
+func ListBranchesWithoutWorktree() ([]string, error) {
+	branches, err := listGitBranches()
+	if err != nil {
+		return nil, err
+	}
+
+	worktrees, err := ListGitWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	checkedOut := make(map[string]bool, len(worktrees))
+	for _, worktree := range worktrees {
+		checkedOut[worktree.Branch] = true
+	}
+
+	result := make([]string, 0, len(branches))
+	for _, branch := range branches {
+		if !checkedOut[branch] {
+			result = append(result, branch)
+		}
+	}
+
+	return result, nil
+}
+
+func SelectWorktreesToRemove() ([]Worktree, error) {
+	worktrees, err := ListGitWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := getGitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	// The main worktree and the one we are standing in cannot be removed.
+	candidates := make([]string, 0, len(worktrees))
+	removable := make([]Worktree, 0, len(worktrees))
+	for _, worktree := range worktrees[1:] {
+		if worktree.Path == current {
+			continue
+		}
+
+		candidates = append(candidates, worktree.String())
+		removable = append(removable, worktree)
+	}
+
+	if len(removable) == 0 {
+		return nil, nil
+	}
+
+	var selected []string
+	if err := survey.AskOne(&survey.MultiSelect{
+		Message: "Select worktrees to remove:",
+		Options: candidates,
+		Help:    "Use space to select, enter to confirm",
+	}, &selected); err != nil {
+		return nil, err
+	}
+
+	selectedWorktrees := make([]Worktree, 0, len(selected))
+	for _, s := range selected {
+		for _, worktree := range removable {
+			if s == worktree.String() {
+				selectedWorktrees = append(selectedWorktrees, worktree)
+				break
+			}
+		}
+	}
+
+	return selectedWorktrees, nil
+}
+
+func PrintGitWorktrees(worktrees []Worktree) {
+	tbl := table.NewTableBuilder("BRANCH", "PATH", "HEAD", "STATE")
+	for _, worktree := range worktrees {
+		head := worktree.Head
+		if len(head) > 7 {
+			head = head[:7]
+		}
+		tbl.AppendRow(worktree.Branch, worktree.Path, head, worktree.state())
+	}
+	tbl.Print()
+}
+
+// gitWorktreeCdFileEnv names the file the shell function of PrintGitWorktreeShellFunction reads the
+// directory to change to from, since a child process cannot change the directory of its shell.
+const gitWorktreeCdFileEnv = "AKO_CD_FILE"
+
+const gitWorktreeShellFunction = `ako() {
+	local ako_cd_file ako_status ako_dir
+	ako_cd_file="$(mktemp)" || return
+	AKO_CD_FILE="$ako_cd_file" command ako "$@"
+	ako_status=$?
+	ako_dir="$(cat "$ako_cd_file")"
+	rm -f "$ako_cd_file"
+	if [ -n "$ako_dir" ]; then
+		cd "$ako_dir" || return
+	fi
+	return $ako_status
+}
+`
+
+// PrintGitWorktreeShellFunction prints the shell function that wraps ako, so that moving to a
+// worktree changes the directory of the calling shell.
+func PrintGitWorktreeShellFunction() {
+	fmt.Print(gitWorktreeShellFunction)
+}
+
+// EnterGitWorktree hands the worktree's path to the shell function when it wraps ako, and prints it
+// to change to otherwise.
+func EnterGitWorktree(worktree *Worktree) error {
+	current, err := getGitTopLevel()
+	if err != nil {
+		return err
+	}
+
+	if worktree.Path == current {
+		log.Printf("Already in worktree: %s", worktree.Path)
+		return nil
+	}
+
+	if cdFile := os.Getenv(gitWorktreeCdFileEnv); cdFile != "" {
+		if err := os.WriteFile(cdFile, []byte(worktree.Path), 0600); err != nil {
+			return err
+		}
+
+		log.Printf("Moved to worktree of %s: %s", worktree.Branch, worktree.Path)
+		return nil
+	}
+
+	log.Printf("Worktree of %s is at the path below, cd into it or add 'eval \"$(ako branch worktree shell)\"' to your shell profile to move there directly", worktree.Branch)
+	fmt.Println(worktree.Path)
+
+	return nil
+}
+
+// MoveToGitBranch switches to the branch in place unless it lives in a worktree, in which case it
+// enters that worktree. With useWorktree set, a missing worktree is created first.
+func MoveToGitBranch(branchName string, useWorktree bool) error {
+	worktree, err := FindGitWorktreeOf(branchName)
+	if err != nil {
+		return err
+	}
+
+	if worktree == nil && useWorktree {
+		dir, err := AddGitWorktree(branchName, false)
+		if err != nil {
+			return err
+		}
+
+		worktree = &Worktree{Path: dir, Branch: branchName}
+	}
+
+	if worktree == nil {
+		return SwitchGitBranchTo(branchName)
+	}
+
+	return EnterGitWorktree(worktree)
+}
@@ -138,3 +138,18 @@ func InputGoCmdArgs() ([]string, error) {
 	args = strings.TrimSpace(args)
 	return strings.Fields(args), nil
 }
+
+func RunGoTest(packages ...string) error {
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	cmd := exec.Command("go", append([]string{"test"}, packages...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	return nil
+}